@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/codegangsta/negroni"
 	"html/template"
@@ -11,14 +16,32 @@ import (
 	"nlc_dv/marc"
 	"nlc_dv/search"
 	"os"
-	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"flag"
 )
 
 var flagSkip int
 var flagUtf8 bool
+var flagStrict bool
+var flagEncoding string
+var flagProfile string
+var flagMapping string
+var flagIndex string
+var flagBuild bool
+var flagK1 float64
+var flagB float64
+var flagDict string
+var flagDelta string
+var flagCodeTables string
+
+// textAnalyzer 用于题名、摘要分词，指定 -dict 时按词典切分
+var textAnalyzer = search.DefaultAnalyzer
+
+const indexVersion = 11
+
+var errIndexStale = errors.New("index does not match source file")
 
 var ds *DataStore
 
@@ -30,7 +53,12 @@ type Doc struct {
 	Desc   string   `json:"desc"`
 	Author []string `json:"author"`
 	URL    string   `json:"url"`
-	keyword string
+	Extra  map[string][]string `json:"extra,omitempty"`
+	Keyword string `json:"-"`
+	// CN 为记录控制号(001)，用于增量文件替换已有记录
+	CN string `json:"-"`
+	// Headings 为按主题词串分组的 Terms，每组作为 term 字段的一个值索引
+	Headings [][]string `json:"-"`
 }
 
 type DataStore struct {
@@ -41,6 +69,9 @@ type DataStore struct {
 	searcher     *search.Searcher
 	yearStatData []*YearStat
 	yearStatMap  map[int]*YearStat
+	// cns 为控制号对应的记录 Id，deltas 为已应用的增量文件的 sha1
+	cns    map[string]int
+	deltas []string
 }
 
 type YearStat struct {
@@ -105,8 +136,39 @@ func (y *YearStat) initKeywords() {
 
 func (d *DataStore) Add(doc *Doc) {
 	d.dn++
-	d.Docs[d.dn] = doc
 	doc.Id = d.dn
+	d.put(doc)
+}
+
+// Replace 用 doc 替换控制号相同的已有记录并沿用其 Id，同时更新检索索引；没有这样的记录时添加 doc
+func (d *DataStore) Replace(doc *Doc) {
+	id, ok := d.cns[doc.CN]
+	if doc.CN == "" || !ok {
+		d.Add(doc)
+		d.searcher.Add(docForSearch(doc))
+		return
+	}
+	old := d.Docs[id]
+	if y, e := d.yearStatMap[old.Year]; e {
+		y.Quantity--
+		y.words[old.Keyword]--
+		if y.words[old.Keyword] <= 0 {
+			delete(y.words, old.Keyword)
+		}
+		if y.Quantity <= 0 {
+			delete(d.yearStatMap, old.Year)
+		}
+	}
+	doc.Id = id
+	d.put(doc)
+	d.searcher.Update(&search.Term{"id", strconv.Itoa(id)}, docForSearch(doc))
+}
+
+func (d *DataStore) put(doc *Doc) {
+	d.Docs[doc.Id] = doc
+	if doc.CN != "" {
+		d.cns[doc.CN] = doc.Id
+	}
 	y, e := d.yearStatMap[doc.Year]
 	if !e {
 		y = &YearStat{Year: doc.Year, Quantity: 1, words: map[string]int{}}
@@ -121,10 +183,10 @@ func (d *DataStore) Add(doc *Doc) {
 			id = d.tn
 			d.Lexicon[v] = id
 		}
-		d.searcher.Put(id, d.dn)
+		d.searcher.Put(id, doc.Id)
 		//y.AddWord(v)
 	}
-	y.AddWord(doc.keyword)
+	y.AddWord(doc.Keyword)
 }
 
 func (d *DataStore) initYearStat() {
@@ -139,41 +201,76 @@ func (d *DataStore) initYearStat() {
 	sort.Sort(ByYear(d.yearStatData))
 }
 
-func (d *DataStore) searchToDoc(sr *search.SearchResult) ([]*Doc, int) {
+// searchParams 为检索条件，Query 为查询语句，Word 为主题词，二者计算相关度；
+// Filters 为须同时满足的过滤条件，不影响相关度
+type searchParams struct {
+	Query   string
+	Word    string
+	Filters []search.Filter
+	Order   []search.SortField
+	Facets  []*search.FacetRequest
+	Start   int
+	Limit   int
+}
+
+type searchResult struct {
+	Docs   []*Doc                          `json:"docs"`
+	Scores []float64                       `json:"scores"`
+	Total  int                             `json:"total"`
+	Facets map[string][]*search.FacetCount `json:"facets,omitempty"`
+}
+
+func (d *DataStore) searchToDoc(sr *search.SearchResult) *searchResult {
+	res := &searchResult{}
 	if sr == nil || sr.Docs == nil {
-		return nil, 0
+		return res
 	}
-	res := []*Doc{}
+	res.Docs = []*Doc{}
 	for _, v := range sr.Docs {
 		for _, f := range v.Fields {
 			if f.GetName() == "id" {
-				res = append(res, d.Docs[f.GetValue().(int)])
+				res.Docs = append(res.Docs, d.Docs[f.GetValue().(int)])
 				break
 			}
 		}
 	}
-	return res, sr.Total
+	res.Scores, res.Total, res.Facets = sr.Scores, sr.Total, sr.Facets
+	return res
 }
 
-func (d *DataStore) Find(term string, year string, start int, limit int) ([]*Doc, int) {
+// Search 按查询语句、关键词、年份等条件检索，如 term:北京 AND year:[1950 TO 1960] NOT term:上海。
+// 没有任何条件时返回空结果
+func (d *DataStore) Search(p *searchParams) (*searchResult, error) {
+	bq := search.NewBooleanQuery()
+	if p.Query != "" {
+		q, err := search.ParseQuery(p.Query, "term")
+		if err != nil {
+			return nil, err
+		}
+		bq.Add(q, search.MUST)
+	}
+	if p.Word != "" {
+		bq.Add(&search.TermQuery{&search.Term{"term", p.Word}}, search.MUST)
+	}
 	var q search.Query
-	if term == "" && year == "" {
-		return nil, 0
+	switch len(bq.Clauses) {
+	case 0:
+	case 1:
+		q = bq.Clauses[0].Q
+	default:
+		q = bq
 	}
-	if term == "" && year != "" {
-		q = &search.TermPageQuery{search.TermQuery{&search.Term{"year", year}}, start, limit}
-	} else if term != "" && year == "" {
-		q = &search.TermPageQuery{search.TermQuery{&search.Term{"term", term}}, start, limit}
-	} else {
-		q = &search.BooleanQuery{
-			&search.TermQuery{&search.Term{"term", term}},
-			&search.TermQuery{&search.Term{"year", year}},
-			search.MUST,
-			start,
-			limit}
+	switch len(p.Filters) {
+	case 0:
+		if q == nil {
+			return &searchResult{}, nil
+		}
+	case 1:
+		q = &search.FilteredQuery{q, p.Filters[0]}
+	default:
+		q = &search.FilteredQuery{q, &search.BooleanFilter{Must: p.Filters}}
 	}
-	fmt.Println(reflect.TypeOf(q))
-	return d.searchToDoc(d.searcher.Find(q))
+	return d.searchToDoc(d.searcher.FindFacets(&search.PageQuery{q, p.Start, p.Limit}, p.Facets, p.Order...)), nil
 }
 
 func check(e error) {
@@ -182,98 +279,269 @@ func check(e error) {
 	}
 }
 
-func parseYear(f string) (int, error) {
-	sf := marc.ParseSubfield(f, 'a')
-	r := []rune(sf)
-	ys := string(r[9:13])
-	return strconv.Atoi(ys)
+func first(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
 }
 
-func convert(r *marc.Record) (doc *Doc) {
-	doc = &Doc{}
-	i := 0
-	for _, v := range r.Field {
-		switch v.Header {
-		case 100:
-			y, err := parseYear(v.Value)
+func convert(r *marc.Record, profile *marc.Profile) (doc *Doc) {
+	if profile == nil {
+		profile = marc.DetectProfile(r)
+	}
+	v := profile.Extract(r)
+	if missing := profile.Missing(v); len(missing) > 0 {
+		fmt.Printf("missing %v: %s %s\r\n", missing, first(v["year"]), first(v["name"]))
+		return nil
+	}
+	doc = &Doc{Headings: profile.ExtractGroups(r)["terms"]}
+	for _, f := range r.Fields(1) {
+		doc.CN = strings.TrimSpace(f.Data())
+		break
+	}
+	for k, val := range v {
+		switch k {
+		case "year":
+			y, err := strconv.Atoi(first(val))
 			if err != nil {
-				//if err != nil || y < 1949 {
 				return nil
 			}
-			//fmt.Println(y)
 			doc.Year = y
-			i = i | 1
-		case 200:
-			doc.Name = marc.ParseSubfield(v.Value, 'a')
-			//fmt.Println(doc.Name)
-			i = i | 2
-		case 606:
-			doc.Terms = marc.ParseAllSubfield(v.Value)
-			doc.keyword = marc.ParseSubfield(v.Value, 'a')
-			//fmt.Println(v.Value, doc.Terms)
-			if len(doc.Terms) > 0 {
-				i = i | 4
-			}
-		case 330:
-			doc.Desc = marc.ParseSubfield(v.Value, 'a')
-			i = i | 8
-		case 701:
-			if doc.Author == nil {
-				doc.Author = []string{}
-			}
-			au := marc.ParseSubfield(v.Value, 'a')
-			if au != "" {
-				doc.Author = append(doc.Author, au)
-				if i&16 == 0 {
-					i = i | 16
-				}
+		case "name":
+			doc.Name = first(val)
+		case "terms":
+			doc.Terms = val
+		case "keyword":
+			doc.Keyword = first(val)
+		case "desc":
+			doc.Desc = first(val)
+		case "author":
+			doc.Author = val
+		case "url":
+			doc.URL = first(val)
+		default:
+			if doc.Extra == nil {
+				doc.Extra = map[string][]string{}
 			}
-		case 856:
-			doc.URL = marc.ParseSubfield(v.Value, 'u')
-			i = i | 32
+			doc.Extra[k] = val
 		}
 	}
-	if (i & 7) < 7 {
-		fmt.Printf("%d %s %s\r\n", doc.Year, doc.Name, doc.Desc)
-		//fmt.Println(doc.Terms)
-		return nil
-	}
 	return doc
 }
 
 func docForSearch(doc *Doc) *search.Document {
 	fid := &search.IntField{search.BaseField{true, "id"}, doc.Id}
 	fyear := &search.IntField{search.BaseField{true, "year"}, doc.Year}
-	fterms := &search.StrSliceField{search.BaseField{true, "term"}, doc.Terms}
-	fields := []search.Field{fid, fyear, fterms}
+	fauthor := &search.StrSliceField{search.BaseField{true, "author"}, doc.Author}
+	fname := &search.TextField{search.BaseField{true, "name"}, doc.Name}
+	fdesc := &search.TextField{search.BaseField{true, "desc"}, doc.Desc}
+	fields := []search.Field{fid, fyear}
+	// 每条主题词串作为一个值，短语查询不跨主题词串匹配
+	if len(doc.Headings) == 0 {
+		fields = append(fields, &search.StrSliceField{search.BaseField{true, "term"}, doc.Terms})
+	}
+	for _, h := range doc.Headings {
+		fields = append(fields, &search.StrSliceField{search.BaseField{true, "term"}, h})
+	}
+	fields = append(fields, fauthor, fname, fdesc)
 	return &search.Document{fields}
 }
 
-func readFile(fp string, skip int, chinese bool) *DataStore {
-	searcher := search.NewSearcher()
-	ds := &DataStore{
+// setupSearcher 为分词字段指定 textAnalyzer，主题词不切分，只统一繁简写法；
+// 年份作为过滤字段，责任者取值多，过滤时由倒排表生成 bitmap 并缓存；sortFields 中的字段作为排序字段
+func setupSearcher(s *search.Searcher) {
+	s.SetAnalyzer("term", search.KeywordAnalyzer)
+	s.SetAnalyzer("name", textAnalyzer)
+	s.SetAnalyzer("desc", textAnalyzer)
+	s.SetFilterField("year")
+	for _, f := range sortFields {
+		s.SetSortField(f)
+	}
+}
+
+func newDataStore(searcher *search.Searcher) *DataStore {
+	return &DataStore{
 		searcher:    searcher,
 		Lexicon:     map[string]int{},
 		Docs:        map[int]*Doc{},
 		yearStatMap: map[int]*YearStat{},
+		cns:         map[string]int{},
 	}
+}
+
+func readFile(fp string, skip int, enc marc.Encoding, mode marc.Mode, profile *marc.Profile) *DataStore {
+	searcher := search.NewSearcher()
+	setupSearcher(searcher)
+	ds := newDataStore(searcher)
+	ds.readRecords(fp, skip, enc, mode, profile, false)
+	ds.initYearStat()
+	return ds
+}
+
+// readRecords 解析 CNMARC 文件并添加其中的记录，添加的记录封存为一个新的段。
+// replace 为 true 时替换控制号相同的已有记录
+func (d *DataStore) readRecords(fp string, skip int, enc marc.Encoding, mode marc.Mode, profile *marc.Profile, replace bool) {
 	f, err := os.Open(fp)
 	check(err)
-	r := marc.NewReader(f, skip, chinese)
+	defer f.Close()
+	r := marc.NewRecordReader(f, skip, enc)
+	r.SetMode(mode)
 	for {
 		rc, err := r.Read()
 		if err == io.EOF {
 			break
 		}
 		check(err)
-		doc := convert(rc)
-		if doc != nil {
-			ds.Add(doc)
-			searcher.Add(docForSearch(doc))
+		doc := convert(rc, profile)
+		if doc == nil {
+			continue
+		}
+		if replace {
+			d.Replace(doc)
+		} else {
+			d.Add(doc)
+			d.searcher.Add(docForSearch(doc))
+		}
+	}
+	fmt.Print(r.Report())
+	for _, e := range r.Errors() {
+		fmt.Println(e)
+	}
+	d.searcher.Flush()
+}
+
+// readDelta 依次读取每日增量文件，每个文件作为一个新的段加入索引，控制号相同的已有记录被替换。
+// 已应用过的文件(内容的 sha1 相同)跳过，返回是否应用了新的文件
+func (d *DataStore) readDelta(files string, skip int, enc marc.Encoding, mode marc.Mode, profile *marc.Profile) bool {
+	applied := false
+	for _, fp := range strings.Split(files, ",") {
+		if fp = strings.TrimSpace(fp); fp == "" {
+			continue
+		}
+		h, err := sourceHeader(fp, "")
+		check(err)
+		if d.hasDelta(h.Hash) {
+			continue
+		}
+		d.readRecords(fp, skip, enc, mode, profile, true)
+		d.deltas = append(d.deltas, h.Hash)
+		applied = true
+	}
+	d.initYearStat()
+	return applied
+}
+
+func (d *DataStore) hasDelta(hash string) bool {
+	for _, v := range d.deltas {
+		if v == hash {
+			return true
 		}
 	}
+	return false
+}
+
+// indexHeader 为索引文件头，Deltas 为已写入索引的增量文件的 sha1，以逗号分隔，
+// 不参与索引与源文件是否一致的判断
+type indexHeader struct {
+	Version int
+	Size    int64
+	Hash    string
+	Options string
+	Deltas  string
+}
+
+func sourceHeader(fp string, options string) (*indexHeader, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha1.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &indexHeader{indexVersion, n, hex.EncodeToString(h.Sum(nil)), options, ""}, nil
+}
+
+// saveIndex 将文档及检索索引写入索引文件，先写临时文件再改名，文件头记录已应用的增量文件
+func (d *DataStore) saveIndex(fp string, h *indexHeader) error {
+	tmp := fp + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	docs := make([]*Doc, 0, len(d.Docs))
+	for i := 1; i <= d.dn; i++ {
+		docs = append(docs, d.Docs[i])
+	}
+	hd := *h
+	hd.Deltas = strings.Join(d.deltas, ",")
+	e := gob.NewEncoder(w)
+	err = e.Encode(&hd)
+	if err != nil {
+		return err
+	}
+	err = e.Encode(docs)
+	if err != nil {
+		return err
+	}
+	err = d.searcher.Save(w)
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+// loadIndex 读取索引文件，与源文件不一致时返回 errIndexStale
+func loadIndex(fp string, h *indexHeader) (*DataStore, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	d := gob.NewDecoder(r)
+	ih := &indexHeader{}
+	err = d.Decode(ih)
+	if err != nil {
+		return nil, err
+	}
+	deltas := ih.Deltas
+	ih.Deltas = h.Deltas
+	if *ih != *h {
+		return nil, errIndexStale
+	}
+	docs := []*Doc{}
+	err = d.Decode(&docs)
+	if err != nil {
+		return nil, err
+	}
+	searcher, err := search.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	setupSearcher(searcher)
+	ds := newDataStore(searcher)
+	for _, doc := range docs {
+		ds.Add(doc)
+	}
+	if deltas != "" {
+		ds.deltas = strings.Split(deltas, ",")
+	}
 	ds.initYearStat()
-	return ds
+	return ds, nil
 }
 
 func home(w http.ResponseWriter, r *http.Request) {
@@ -290,6 +558,13 @@ func writeJson(w http.ResponseWriter, d interface{}) {
 	w.Write(b)
 }
 
+func writeJsonError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Write(b)
+}
+
 func limitStatData(data []*YearStat, limit int) []*YearStat {
 	res := make([]*YearStat, len(data))
 	for i, item := range data {
@@ -307,16 +582,102 @@ func yearJson(w http.ResponseWriter, r *http.Request) {
 	writeJson(w, limitStatData(ds.yearStatData, 100))
 }
 
+// facetFields 为 /search.json 的 facet 参数可以指定的字段
+var facetFields = map[string]bool{"year": true, "author": true, "term": true}
+
 func findDoc(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	fmt.Println(q)
-	data := map[string]interface{}{}
-	start := getIntParam(q, "start", 0)
-	limit := getIntParam(q, "limit", 50)
-	docs, total := ds.Find(q.Get("word"), q.Get("year"), start, limit)
-	data["docs"] = docs
-	data["total"] = total
-	writeJson(w, data)
+	p := &searchParams{
+		Query: q.Get("q"),
+		Word:  q.Get("word"),
+		Start: getIntParam(q, "start", 0),
+		Limit: getIntParam(q, "limit", 50),
+	}
+	for _, f := range []string{"year", "author"} {
+		if v := q.Get(f); v != "" {
+			p.Filters = append(p.Filters, &search.TermFilter{&search.Term{f, v}})
+		}
+	}
+	// 点击主题词分面时保留 word，所选主题词以多个 term 参数传入
+	for _, v := range q["term"] {
+		if v != "" {
+			p.Filters = append(p.Filters, &search.TermFilter{&search.Term{"term", v}})
+		}
+	}
+	years, err := getYearRange(q)
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	if years != nil {
+		p.Filters = append(p.Filters, &search.RangeFilter{years})
+	}
+	p.Order, err = getSort(q)
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, f := range q["facet"] {
+		if !facetFields[f] {
+			writeJsonError(w, http.StatusBadRequest, fmt.Errorf("invalid facet %q", f))
+			return
+		}
+		p.Facets = append(p.Facets, &search.FacetRequest{f, getIntParam(q, "facetLimit", 10)})
+	}
+	res, err := ds.Search(p)
+	if err != nil {
+		writeJsonError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, res)
+}
+
+// getYearRange 解析 yearFrom、yearTo 参数（均包含边界），都未指定时返回 nil
+func getYearRange(q url.Values) (*search.RangeQuery, error) {
+	from, to := q.Get("yearFrom"), q.Get("yearTo")
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	rq := &search.RangeQuery{Field: "year", NoMin: from == "", NoMax: to == ""}
+	var err error
+	if from != "" {
+		if rq.Min, err = strconv.Atoi(from); err != nil {
+			return nil, fmt.Errorf("invalid yearFrom %q", from)
+		}
+	}
+	if to != "" {
+		if rq.Max, err = strconv.Atoi(to); err != nil {
+			return nil, fmt.Errorf("invalid yearTo %q", to)
+		}
+	}
+	return rq, nil
+}
+
+// sortFields 为可排序的字段，title 同 name
+var sortFields = map[string]string{"year": "year", "name": "name", "title": "name", "author": "author", "id": "id"}
+
+// getSort 解析 sort 参数，如 year desc, name asc，各项默认升序；
+// relevance(或 score) 按相关度降序，未指定时按相关度排序
+func getSort(q url.Values) ([]search.SortField, error) {
+	if q.Get("sort") == "" {
+		return nil, nil
+	}
+	order, err := search.ParseSort(q.Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range order {
+		if f.Field == "" {
+			continue
+		}
+		field, ok := sortFields[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort field %q", f.Field)
+		}
+		order[i].Field = field
+	}
+	return order, nil
 }
 
 func getIntParam(q url.Values, key string, def int) int {
@@ -333,7 +694,18 @@ func getIntParam(q url.Values, key string, def int) int {
 
 func initFlag(){
 	flag.IntVar(&flagSkip, "skip", 0, "每条记录解析后需跳过的字节数")
-	flag.BoolVar(&flagUtf8, "utf8", true, "CNMARC文件是否是utf8编码")
+	flag.BoolVar(&flagUtf8, "utf8", true, "CNMARC文件是否是utf8编码，指定时覆盖 -encoding")
+	flag.StringVar(&flagEncoding, "encoding", "auto", "CNMARC文件编码: auto, utf8, gb18030, gbk, big5, marc8")
+	flag.StringVar(&flagProfile, "profile", "auto", "记录格式: auto(根据题名字段 200/245 及 008 判断), cnmarc, marc21")
+	flag.StringVar(&flagMapping, "mapping", "", "字段映射配置文件(JSON)，指定时忽略 -profile")
+	flag.BoolVar(&flagStrict, "strict", false, "遇到格式错误的记录时是否停止解析，默认跳过并在结束时输出错误汇总")
+	flag.StringVar(&flagIndex, "index", "", "索引文件路径，存在且与CNMARC文件一致时直接加载，否则解析后写入")
+	flag.BoolVar(&flagBuild, "build", false, "只生成 -index 指定的索引文件后退出")
+	flag.Float64Var(&flagK1, "k1", search.DefaultBM25.K1, "BM25 相关度参数 k1，控制词频的影响")
+	flag.Float64Var(&flagB, "b", search.DefaultBM25.B, "BM25 相关度参数 b，控制字段长度的影响")
+	flag.StringVar(&flagDict, "dict", "", "分词词典路径，每行一个词，默认题名、摘要按二元切分")
+	flag.StringVar(&flagCodeTables, "codetables", "", "MARC-8 代码表(美国国会图书馆 codetables.xml)，用于解码 EACC 等字符集")
+	flag.StringVar(&flagDelta, "delta", "", "每日增量 CNMARC 文件路径，多个文件以逗号分隔，启动后作为新的段加入索引并按控制号替换已有记录，指定 -index 时写入索引文件")
 }
 
 func main() {
@@ -344,7 +716,90 @@ func main() {
 	}
 	file := flag.Arg(0)
 
-	ds = readFile(file, flagSkip, !flagUtf8)
+	mode := marc.Lenient
+	if flagStrict {
+		mode = marc.Strict
+	}
+	enc, err := marc.ParseEncoding(flagEncoding)
+	check(err)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "utf8" {
+			return
+		}
+		enc = marc.UTF8
+		if !flagUtf8 {
+			enc = marc.GB18030
+		}
+	})
+	var profile *marc.Profile
+	if flagMapping != "" {
+		profile, err = marc.LoadProfile(flagMapping)
+		check(err)
+	} else if flagProfile != "auto" {
+		p, ok := marc.GetProfile(flagProfile)
+		if !ok {
+			panic("未知的记录格式: " + flagProfile)
+		}
+		profile = p
+	}
+	if flagCodeTables != "" {
+		f, err := os.Open(flagCodeTables)
+		check(err)
+		err = marc.LoadCodeTables(f)
+		f.Close()
+		check(err)
+	}
+	if flagDict != "" {
+		f, err := os.Open(flagDict)
+		check(err)
+		dict, err := search.ReadDict(f)
+		f.Close()
+		check(err)
+		textAnalyzer = search.NewAnalyzer(dict, &search.LowercaseFilter{}, &search.SimplifiedFilter{})
+	}
+	var h *indexHeader
+	if flagIndex == "" {
+		if flagBuild {
+			panic("-build 需要指定 -index")
+		}
+		ds = readFile(file, flagSkip, enc, mode, profile)
+	} else {
+		options := fmt.Sprintf("skip=%d encoding=%s profile=%s", flagSkip, enc, flagProfile)
+		if flagMapping != "" {
+			mh, err := sourceHeader(flagMapping, "")
+			check(err)
+			options = fmt.Sprintf("%s mapping=%s", options, mh.Hash)
+		}
+		if flagDict != "" {
+			dh, err := sourceHeader(flagDict, "")
+			check(err)
+			options = fmt.Sprintf("%s dict=%s", options, dh.Hash)
+		}
+		if flagCodeTables != "" {
+			ch, err := sourceHeader(flagCodeTables, "")
+			check(err)
+			options = fmt.Sprintf("%s codetables=%s", options, ch.Hash)
+		}
+		h, err = sourceHeader(file, options)
+		check(err)
+		if !flagBuild {
+			ds, err = loadIndex(flagIndex, h)
+			if err != nil {
+				fmt.Println("load index: ", err)
+			}
+		}
+		if ds == nil {
+			ds = readFile(file, flagSkip, enc, mode, profile)
+			check(ds.saveIndex(flagIndex, h))
+		}
+		if flagBuild {
+			return
+		}
+	}
+	if flagDelta != "" && ds.readDelta(flagDelta, flagSkip, enc, mode, profile) && h != nil {
+		check(ds.saveIndex(flagIndex, h))
+	}
+	ds.searcher.SetBM25(search.BM25{flagK1, flagB})
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/data.json", yearJson)
@@ -0,0 +1,346 @@
+package marc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/unicode/norm"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Encoding int
+
+const (
+	UTF8    Encoding = iota
+	GB18030 Encoding = iota
+	GBK     Encoding = iota
+	Big5    Encoding = iota
+	MARC8   Encoding = iota
+	Auto    Encoding = iota
+)
+
+var encodingNames = []string{"utf8", "gb18030", "gbk", "big5", "marc8", "auto"}
+
+func (e Encoding) String() string {
+	if e < 0 || int(e) >= len(encodingNames) {
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+	return encodingNames[e]
+}
+
+func ParseEncoding(name string) (Encoding, error) {
+	n := strings.Replace(strings.ToLower(name), "-", "", -1)
+	for i, v := range encodingNames {
+		if v == n {
+			return Encoding(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown encoding %q", name)
+}
+
+func (e Encoding) decoder() *encoding.Decoder {
+	switch e {
+	case GB18030:
+		return simplifiedchinese.GB18030.NewDecoder()
+	case GBK:
+		return simplifiedchinese.GBK.NewDecoder()
+	case Big5:
+		return traditionalchinese.Big5.NewDecoder()
+	}
+	return nil
+}
+
+func decode(field []byte, enc Encoding) (s string, err error) {
+	if enc == MARC8 {
+		return decodeMARC8(field), nil
+	}
+	d := enc.decoder()
+	if d == nil {
+		return string(field), nil
+	}
+	o := d.Reader(bytes.NewReader(field))
+	b, err := ioutil.ReadAll(o)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DetectEncoding 根据字节分布判断记录编码：含 ESC 转义序列为 MARC-8，合法的 UTF-8 为 UTF-8，
+// 其余按双字节字符落在 GB2312 与 Big5 常用字区的多少区分 GB18030 与 Big5，无法区分时返回 def。
+func DetectEncoding(line []byte, def Encoding) Encoding {
+	if bytes.IndexByte(line, 0x1b) >= 0 {
+		return MARC8
+	}
+	ascii := true
+	for _, c := range line {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		if def == Auto {
+			return UTF8
+		}
+		return def
+	}
+	if utf8.Valid(line) {
+		return UTF8
+	}
+	gb, big5 := 0, 0
+	for i := 0; i < len(line)-1; i++ {
+		c, n := line[i], line[i+1]
+		if c < 0x81 {
+			continue
+		}
+		// 四字节序列及 Big5 中不存在的首尾字节只能是 GB18030
+		if c <= 0xfe && n >= 0x30 && n <= 0x39 {
+			return GB18030
+		}
+		if c <= 0xa0 || c >= 0xfa || n < 0x40 || n >= 0x7f && n <= 0xa0 || n == 0xff {
+			return GB18030
+		}
+		gb += gbScore(c, n)
+		big5 += big5Score(c, n)
+		i++
+	}
+	switch {
+	case gb > big5:
+		return GB18030
+	case big5 > gb:
+		return Big5
+	}
+	if def == GB18030 || def == GBK || def == Big5 {
+		return def
+	}
+	return GB18030
+}
+
+// gbScore 为双字节字符作为 GB2312 的得分：一级汉字(B0-D7)2 分，二级汉字(D8-F7)及标点 1 分，
+// 日文假名、希腊字母等其他区及 GBK 扩展区(尾字节小于 A1)不计分
+func gbScore(c byte, n byte) int {
+	switch {
+	case n < 0xa1:
+		return 0
+	case c >= 0xb0 && c <= 0xd7:
+		return 2
+	case c >= 0xd8 && c <= 0xf7, c >= 0xa1 && c <= 0xa3:
+		return 1
+	}
+	return 0
+}
+
+// big5Score 为双字节字符作为 Big5 的得分：常用字(A4-C6)2 分，次常用字(C9-F9)及标点 1 分
+func big5Score(c byte, n byte) int {
+	switch {
+	case c >= 0xa4 && c <= 0xc6:
+		return 2
+	case c >= 0xc9 && c <= 0xf9, c >= 0xa1 && c <= 0xa3:
+		return 1
+	}
+	return 0
+}
+
+// encodingHint 读取记录中的编码标识：头标区/09 为 a 时为 UTF-8，MARC 21 中为空格时为 MARC-8；
+// CNMARC 100$a/26-27 为 50 时为 UTF-8
+func encodingHint(line []byte, label *RecordLabel, dict []*RecordDict, ds int) (Encoding, bool) {
+	if label.Coding == 'a' {
+		return UTF8, true
+	}
+	tags := make([]int, len(dict))
+	for i, d := range dict {
+		tags[i] = d.Tag
+	}
+	if isMARC21(tags) {
+		if label.Coding == ' ' {
+			return MARC8, true
+		}
+		return Auto, false
+	}
+	for _, d := range dict {
+		if d.Tag != 100 {
+			continue
+		}
+		f := line[ds+d.FieldStart : ds+d.FieldStart+d.Length]
+		i := bytes.IndexByte(f, subSeparator)
+		if i < 0 || i+2+28 > len(f) || f[i+1] != 'a' {
+			break
+		}
+		cs := string(f[i+2+26 : i+2+28])
+		if cs == "50" {
+			return UTF8, true
+		}
+		break
+	}
+	return Auto, false
+}
+
+var ansel = map[byte]rune{
+	0xa1: 'Ł', 0xa2: 'Ø', 0xa3: 'Đ', 0xa4: 'Þ', 0xa5: 'Æ', 0xa6: 'Œ', 0xa7: 'ʹ',
+	0xa8: '·', 0xa9: '♭', 0xaa: '®', 0xab: '±', 0xac: 'Ơ', 0xad: 'Ư', 0xae: 'ʼ',
+	0xb0: 'ʻ', 0xb1: 'ł', 0xb2: 'ø', 0xb3: 'đ', 0xb4: 'þ', 0xb5: 'æ', 0xb6: 'œ',
+	0xb7: 'ʺ', 0xb8: 'ı', 0xb9: '£', 0xba: 'ð', 0xbc: 'ơ', 0xbd: 'ư',
+	0xc0: '°', 0xc1: 'ℓ', 0xc2: '℗', 0xc3: '©', 0xc4: '♯', 0xc5: '¿', 0xc6: '¡',
+	0xc7: 'ß', 0xc8: '€',
+	0xe0: '\u0309', 0xe1: '\u0300', 0xe2: '\u0301', 0xe3: '\u0302', 0xe4: '\u0303',
+	0xe5: '\u0304', 0xe6: '\u0306', 0xe7: '\u0307', 0xe8: '\u0308', 0xe9: '\u030c',
+	0xea: '\u030a', 0xeb: '\ufe20', 0xec: '\ufe21', 0xed: '\u0315', 0xee: '\u030b',
+	0xef: '\u0310', 0xf0: '\u0327', 0xf1: '\u0328', 0xf2: '\u0323', 0xf3: '\u0324',
+	0xf4: '\u0325', 0xf5: '\u0333', 0xf6: '\u0332', 0xf7: '\u0326', 0xf8: '\u031c',
+	0xf9: '\u032e', 0xfa: '\ufe22', 0xfb: '\ufe23', 0xfe: '\u0313',
+}
+
+// codeTable 为 LoadCodeTables 读取的一个 MARC-8 字符集，键为去掉最高位后的字节序列
+type codeTable struct {
+	chars     map[int]rune
+	combining map[int]bool
+}
+
+// codeTables 的键为切换到该字符集的 ESC 序列的终止字节，如 EACC 为 '1'
+var codeTables = map[byte]*codeTable{}
+
+type xmlCodeTables struct {
+	Tables []struct {
+		Number string `xml:"number,attr"`
+		Codes  []struct {
+			Marc      string `xml:"marc"`
+			Ucs       string `xml:"ucs"`
+			Alt       string `xml:"alt"`
+			Combining bool   `xml:"isCombining"`
+		} `xml:"code"`
+	} `xml:"codeTable"`
+}
+
+// LoadCodeTables 读取美国国会图书馆发布的 MARC-8 代码表(codetables.xml)，
+// 用于解码 EACC、希腊文、西里尔文等通过 ESC 切换的字符集，须在读取记录前调用
+func LoadCodeTables(r io.Reader) error {
+	ct := &xmlCodeTables{}
+	if err := xml.NewDecoder(r).Decode(ct); err != nil {
+		return err
+	}
+	for _, t := range ct.Tables {
+		n, err := strconv.ParseUint(t.Number, 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid code table number %q", t.Number)
+		}
+		table := &codeTable{map[int]rune{}, map[int]bool{}}
+		for _, c := range t.Codes {
+			b, err := hex.DecodeString(c.Marc)
+			if err != nil {
+				return fmt.Errorf("invalid MARC-8 code %q", c.Marc)
+			}
+			ucs := c.Ucs
+			if ucs == "" {
+				ucs = c.Alt
+			}
+			u, err := strconv.ParseUint(ucs, 16, 32)
+			if err != nil {
+				continue
+			}
+			k := codeKey(b)
+			table.chars[k] = rune(u)
+			if c.Combining {
+				table.combining[k] = true
+			}
+		}
+		codeTables[byte(n)] = table
+	}
+	return nil
+}
+
+// codeKey 忽略最高位，字符集作为 G0 或 G1 使用时得到相同的键
+func codeKey(b []byte) int {
+	k := 0
+	for _, c := range b {
+		k = k<<8 | int(c&0x7f)
+	}
+	return k
+}
+
+// decodeMARC8 解码 MARC-8 的基本拉丁字符集和 ANSEL 扩展拉丁字符集，
+// 组合附加符号在 MARC-8 中位于基字符之前，解码时移到基字符之后并做 NFC 规范化。
+// 其他字符集(如 EACC)通过 ESC 切换后按 LoadCodeTables 读取的代码表解码，没有代码表或表中没有的字符以 U+FFFD 代替。
+func decodeMARC8(b []byte) string {
+	res := make([]rune, 0, len(b))
+	marks := []rune{}
+	other, width := false, 1
+	var table *codeTable
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c == 0x1b {
+			if i+1 < len(b) && (b[i+1] == 's' || b[i+1] == 'B') {
+				other = false
+				i++
+			} else if i+2 < len(b) && b[i+1] == '(' && b[i+2] == 'B' {
+				other = false
+				i += 2
+			} else {
+				other, width = true, 1
+				for i+1 < len(b) && b[i+1] >= 0x20 && b[i+1] <= 0x2f {
+					if b[i+1] == '$' {
+						width = 3
+					}
+					i++
+				}
+				i++
+				if i < len(b) {
+					table = codeTables[b[i]]
+				}
+			}
+			continue
+		}
+		if c < 0x20 {
+			res = append(res, rune(c))
+			continue
+		}
+		if other {
+			r, n := utf8.RuneError, width
+			if c == 0x20 {
+				r, n = ' ', 1
+			} else if table != nil && i+width <= len(b) {
+				k := codeKey(b[i : i+width])
+				if v, ok := table.chars[k]; ok && table.combining[k] {
+					marks = append(marks, v)
+					i += width - 1
+					continue
+				} else if ok {
+					r = v
+				}
+			}
+			res = append(res, r)
+			res = append(res, marks...)
+			marks = marks[:0]
+			i += n - 1
+			continue
+		}
+		if c < 0x80 {
+			res = append(res, rune(c))
+			res = append(res, marks...)
+			marks = marks[:0]
+			continue
+		}
+		r, ok := ansel[c]
+		if !ok {
+			res = append(res, utf8.RuneError)
+			continue
+		}
+		if c >= 0xe0 {
+			marks = append(marks, r)
+			continue
+		}
+		res = append(res, r)
+		res = append(res, marks...)
+		marks = marks[:0]
+	}
+	res = append(res, marks...)
+	return norm.NFC.String(string(res))
+}
@@ -0,0 +1,113 @@
+package marc
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"strings"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	s := "北京历史 中国近代史"
+	gb, _ := simplifiedchinese.GB18030.NewEncoder().String(s)
+	big5, _ := traditionalchinese.Big5.NewEncoder().String("臺灣歷史研究")
+	// 尾字节都不小于 A1，只能按常用字区区分
+	big5High, _ := traditionalchinese.Big5.NewEncoder().String("中國的學者")
+	gbHigh, _ := simplifiedchinese.GB18030.NewEncoder().String("人民文学出版社")
+	cases := []struct {
+		in   string
+		def  Encoding
+		want Encoding
+	}{
+		{"abc", Auto, UTF8},
+		{s, GB18030, UTF8},
+		{gb, Auto, GB18030},
+		{big5, Auto, Big5},
+		{big5High, Auto, Big5},
+		{big5High, GB18030, Big5},
+		{gbHigh, Big5, GB18030},
+		{"\x1b$1\x21\x30\x21\x1b(B", Auto, MARC8},
+	}
+	for _, c := range cases {
+		if e := DetectEncoding([]byte(c.in), c.def); e != c.want {
+			t.Errorf("DetectEncoding(%q) = %s, want %s", c.in, e, c.want)
+		}
+	}
+}
+
+func TestDecodeMARC8(t *testing.T) {
+	if s := decodeMARC8([]byte("Caf\xe2e \xa5sop")); s != "Café Æsop" {
+		t.Errorf("decodeMARC8 = %q", s)
+	}
+}
+
+func TestReadAuto(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for _, chinese := range []bool{true, false} {
+		w := NewWriter(buf, chinese)
+		check(w.Write(testRecord()))
+		check(w.Flush())
+	}
+	r := NewReader(buf, 0, false)
+	r.SetEncoding(Auto)
+	for _, enc := range []Encoding{GB18030, UTF8} {
+		rc, err := r.Read()
+		check(err)
+		if rc.Encoding != enc || rc.Subfield(200, 'a') != "北京历史" {
+			t.Errorf("encoding %s, 200$a %q", rc.Encoding, rc.Subfield(200, 'a'))
+		}
+	}
+}
+
+func TestReadMARC8Leader(t *testing.T) {
+	// MARC 21 头标区/09 为空格表示 MARC-8，只含 ANSEL 字符时不能按 GB18030 解码
+	rc := &Record{Field: []*RecordField{
+		NewRecordField(8, "150101s2014    xxu           000 0 eng d"),
+		NewRecordField(245, "10\x1faCaf\xe2e \xa5sop"),
+	}}
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, false)
+	check(w.Write(rc))
+	check(w.Flush())
+	// Writer 不写 MARC-8，按 UTF-8 写出后把 09 位改回空格
+	buf.Bytes()[9] = ' '
+	r := NewReader(buf, 0, false)
+	r.SetEncoding(Auto)
+	res, err := r.Read()
+	check(err)
+	if res.Encoding != MARC8 || res.Subfield(245, 'a') != "Café Æsop" {
+		t.Errorf("encoding %s, 245$a %q", res.Encoding, res.Subfield(245, 'a'))
+	}
+}
+
+const testCodeTables = `<?xml version="1.0" encoding="UTF-8"?>
+<codeTables>
+  <codeTable name="East Asian Ideographs (EACC)" number="31">
+    <code><marc>213021</marc><ucs>4E00</ucs><utf-8>E4B880</utf-8><name>One</name></code>
+    <code><marc>213022</marc><ucs>4E01</ucs><utf-8>E4B881</utf-8><name>Male adult</name></code>
+  </codeTable>
+  <codeTable name="Basic Greek" number="53">
+    <code><isCombining>true</isCombining><marc>22</marc><ucs>0308</ucs><name>Diaeresis</name></code>
+    <code><marc>61</marc><ucs>03B1</ucs><name>Alpha</name></code>
+  </codeTable>
+</codeTables>`
+
+func TestDecodeEACC(t *testing.T) {
+	eacc := []byte("A\x1b$1\x21\x30\x21\x21\x30\x22 \x21\x30\x21\x1b(BB")
+	if s := decodeMARC8(eacc); s != "A\ufffd\ufffd \ufffdB" {
+		t.Errorf("without code tables: %q", s)
+	}
+	defer func(old map[byte]*codeTable) {
+		codeTables = old
+	}(codeTables)
+	codeTables = map[byte]*codeTable{}
+	check(LoadCodeTables(strings.NewReader(testCodeTables)))
+	if s := decodeMARC8(eacc); s != "A一丁 一B" {
+		t.Errorf("EACC: %q", s)
+	}
+	// 组合附加符号移到基字符之后
+	if s := decodeMARC8([]byte("\x1b(S\x22\x61\x1b(B")); s != "\u03b1\u0308" {
+		t.Errorf("greek: %q", s)
+	}
+}
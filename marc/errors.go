@@ -0,0 +1,106 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type Mode int
+
+const (
+	Strict  Mode = iota
+	Lenient Mode = iota
+)
+
+var (
+	ErrTruncated = errors.New("MARC record truncated")
+)
+
+type ParseError struct {
+	Record int
+	Offset int64
+	Tag    int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Tag >= 0 {
+		return fmt.Sprintf("record %d (offset %d, tag %03d): %s", e.Record, e.Offset, e.Tag, e.Err)
+	}
+	return fmt.Sprintf("record %d (offset %d): %s", e.Record, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Reason 返回错误类别，用于汇总同类错误，不包含记录相关的细节
+func (e *ParseError) Reason() string {
+	switch err := e.Err.(type) {
+	case *LabelError:
+		return "label " + err.Field
+	case *DictError:
+		return "directory entry"
+	case *FieldError:
+		return "field data"
+	}
+	switch e.Err {
+	case ErrTruncated:
+		return "truncated record"
+	case ErrMarc:
+		return "read error"
+	}
+	return "other"
+}
+
+// FieldError 为字段内容的错误，如无法按记录编码解码
+type FieldError struct {
+	Tag int
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("MARC field %03d: %s", e.Tag, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func newParseError(record int, offset int64, err error) *ParseError {
+	pe := &ParseError{Record: record, Offset: offset, Tag: -1, Err: err}
+	switch e := err.(type) {
+	case *DictError:
+		pe.Tag = e.Tag
+	case *FieldError:
+		pe.Tag = e.Tag
+	}
+	return pe
+}
+
+type ParseReport struct {
+	Records int
+	Errors  []*ParseError
+}
+
+// String 输出解析汇总：成功记录数、跳过记录数及各类错误的数量
+func (p *ParseReport) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "parsed %d records, skipped %d\n", p.Records, len(p.Errors))
+	count := map[string]int{}
+	reasons := []string{}
+	for _, e := range p.Errors {
+		r := e.Reason()
+		if _, ok := count[r]; !ok {
+			reasons = append(reasons, r)
+		}
+		count[r]++
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(buf, "  %6d  %s\n", count[r], r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,130 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testBadFile() []byte {
+	buf := &bytes.Buffer{}
+	good := testLine()
+	bad := testLine()
+	copy(bad[labelLen+3:labelLen+7], "0099")
+	buf.Write(good)
+	buf.Write(bad)
+	buf.Write(good)
+	buf.Write(good[:30])
+	return buf.Bytes()
+}
+
+func TestLenient(t *testing.T) {
+	r := NewReader(bytes.NewReader(testBadFile()), 0, false)
+	r.SetMode(Lenient)
+	n := 0
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		n++
+	}
+	if n != 2 {
+		t.Errorf("read %d records, want 2", n)
+	}
+	errs := r.Errors()
+	if len(errs) != 2 {
+		t.Fatalf("%d errors, want 2", len(errs))
+	}
+	l := int64(len(testLine()))
+	if errs[0].Record != 2 || errs[0].Offset != l || errs[0].Tag != 1 {
+		t.Errorf("unexpected error %v", errs[0])
+	}
+	if errs[1].Record != 4 || errs[1].Offset != 3*l || errs[1].Err != ErrTruncated {
+		t.Errorf("unexpected error %v", errs[1])
+	}
+	report := r.Report().String()
+	if !strings.HasPrefix(report, "parsed 2 records, skipped 2") {
+		t.Errorf("unexpected report %q", report)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	r := NewReader(bytes.NewReader(testBadFile()), 0, false)
+	_, err := r.Read()
+	check(err)
+	_, err = r.Read()
+	if pe, ok := err.(*ParseError); !ok || pe.Record != 2 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// 目录项中带符号的数字不能通过解析，否则切片越界
+func TestNegativeDirectory(t *testing.T) {
+	bad := testLine()
+	copy(bad[labelLen+3:labelLen+12], "0001-0001")
+	file := append(append(append([]byte{}, testLine()...), bad...), testLine()...)
+
+	r := NewReader(bytes.NewReader(file), 0, false)
+	r.SetMode(Lenient)
+	n := 0
+	for {
+		_, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		check(err)
+		n++
+	}
+	if errs := r.Errors(); n != 2 || len(errs) != 1 || errs[0].Record != 2 {
+		t.Errorf("lenient: read %d records, errors %v", n, errs)
+	}
+
+	r = NewReader(bytes.NewReader(file), 0, false)
+	_, err := r.Read()
+	check(err)
+	_, err = r.Read()
+	if pe, ok := err.(*ParseError); !ok || pe.Record != 2 {
+		t.Errorf("strict: unexpected error %v", err)
+	}
+
+	l, err := ParseLabel(testLine())
+	check(err)
+	for _, d := range []*RecordDict{{200, -1, 1}, {200, 0, -1}, {200, 0, 0}} {
+		if err := l.validate(testLine(), []*RecordDict{d}, l.DataStart); err == nil {
+			t.Errorf("%+v: expect directory error", d)
+		}
+	}
+}
+
+func TestReason(t *testing.T) {
+	cases := []struct {
+		err    error
+		reason string
+		tag    int
+	}{
+		{&LabelError{"record length", "label says 1, record has 2 bytes"}, "label record length", -1},
+		{&DictError{1, 0, 99, "exceeds data length 30"}, "directory entry", 1},
+		{&FieldError{200, errors.New("invalid byte")}, "field data", 200},
+		{&FieldError{606, errors.New("unexpected EOF")}, "field data", 606},
+		{ErrTruncated, "truncated record", -1},
+		{errors.New("disk error"), "other", -1},
+	}
+	for _, c := range cases {
+		pe := newParseError(1, 0, c.err)
+		if pe.Reason() != c.reason || pe.Tag != c.tag {
+			t.Errorf("%v: reason %q tag %d, want %q %d", c.err, pe.Reason(), pe.Tag, c.reason, c.tag)
+		}
+	}
+	// 地址目次中的非数字也归为同一类
+	bad := testLine()
+	bad[labelLen+1] = 'x'
+	r := NewReader(bytes.NewReader(bad), 0, false)
+	_, err := r.Read()
+	if pe, ok := err.(*ParseError); !ok || pe.Reason() != "label directory" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package marc
+
+import (
+	"strings"
+)
+
+type RecordField struct {
+	Header    int
+	Value     string
+	Ind1      byte
+	Ind2      byte
+	Subfields []*Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// NewRecordField 根据字段原始内容解析指示符和子字段，控制字段(00X)只保留 Value
+func NewRecordField(tag int, value string) *RecordField {
+	f := &RecordField{Header: tag, Value: value}
+	if f.IsControl() {
+		return f
+	}
+	v := strings.TrimSuffix(value, string(fieldSeparator))
+	f.Ind1, f.Ind2 = ' ', ' '
+	if len(v) > 0 && v[0] != subSeparator {
+		f.Ind1 = v[0]
+		v = v[1:]
+	}
+	if len(v) > 0 && v[0] != subSeparator {
+		f.Ind2 = v[0]
+		v = v[1:]
+	}
+	for _, s := range strings.Split(v, string(subSeparator)) {
+		if s == "" {
+			continue
+		}
+		f.Subfields = append(f.Subfields, &Subfield{s[0], s[1:]})
+	}
+	return f
+}
+
+func (f *RecordField) IsControl() bool {
+	return f.Header < 10
+}
+
+// Data 返回控制字段去掉字段分隔符后的内容
+func (f *RecordField) Data() string {
+	return strings.TrimSuffix(f.Value, string(fieldSeparator))
+}
+
+// data 返回写入时的字段内容。数据字段由指示符和子字段生成，与 XMLWriter 一致，
+// 修改 Subfields 后不必同步 Value；没有指示符和子字段时(未经 NewRecordField 创建)取 Value
+func (f *RecordField) data() string {
+	if f.IsControl() || f.Ind1 == 0 && f.Ind2 == 0 && len(f.Subfields) == 0 {
+		return f.Data()
+	}
+	b := []byte{indicatorByte(f.Ind1), indicatorByte(f.Ind2)}
+	for _, s := range f.Subfields {
+		b = append(b, subSeparator, s.Code)
+		b = append(b, s.Value...)
+	}
+	return string(b)
+}
+
+func indicatorByte(c byte) byte {
+	if c == 0 {
+		return ' '
+	}
+	return c
+}
+
+func (f *RecordField) Subfield(code byte) string {
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func (f *RecordField) SubfieldAll(code byte) []string {
+	res := []string{}
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			res = append(res, s.Value)
+		}
+	}
+	return res
+}
+
+func (f *RecordField) SubfieldValues() []string {
+	res := []string{}
+	for _, s := range f.Subfields {
+		res = append(res, s.Value)
+	}
+	return res
+}
+
+func (r *Record) Fields(tag int) []*RecordField {
+	res := []*RecordField{}
+	for _, f := range r.Field {
+		if f.Header == tag {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// Subfield 返回 tag 字段中第一个非空的 code 子字段
+func (r *Record) Subfield(tag int, code byte) string {
+	for _, f := range r.Field {
+		if f.Header == tag {
+			if s := f.Subfield(code); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// SubfieldAll 返回所有 tag 字段的 code 子字段，如全部 701$a
+func (r *Record) SubfieldAll(tag int, code byte) []string {
+	res := []string{}
+	for _, f := range r.Field {
+		if f.Header == tag {
+			res = append(res, f.SubfieldAll(code)...)
+		}
+	}
+	return res
+}
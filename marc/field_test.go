@@ -0,0 +1,34 @@
+package marc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordField(t *testing.T) {
+	f := NewRecordField(606, "0 \x1fa北京\x1fx历史\x1fy近代\x1e")
+	if f.IsControl() || f.Ind1 != '0' || f.Ind2 != ' ' {
+		t.Errorf("indicators %q %q", f.Ind1, f.Ind2)
+	}
+	if !reflect.DeepEqual(f.SubfieldValues(), ParseAllSubfield(f.Value)) {
+		t.Errorf("subfields %v, want %v", f.SubfieldValues(), ParseAllSubfield(f.Value))
+	}
+	if f.Subfield('x') != ParseSubfield(f.Value, 'x') {
+		t.Errorf("subfield x %q", f.Subfield('x'))
+	}
+	c := NewRecordField(1, "012000000001\x1e")
+	if !c.IsControl() || c.Data() != "012000000001" || len(c.Subfields) != 0 {
+		t.Errorf("control field %v", c)
+	}
+	rc := &Record{Field: []*RecordField{
+		NewRecordField(701, " 0\x1fa张三\x1f4著\x1e"),
+		NewRecordField(200, "1 \x1fa北京历史\x1e"),
+		NewRecordField(701, " 0\x1fa李四\x1fa王五\x1e"),
+	}}
+	if !reflect.DeepEqual(rc.SubfieldAll(701, 'a'), []string{"张三", "李四", "王五"}) {
+		t.Errorf("701$a %v", rc.SubfieldAll(701, 'a'))
+	}
+	if len(rc.Fields(701)) != 2 || rc.Subfield(200, 'a') != "北京历史" {
+		t.Errorf("unexpected fields")
+	}
+}
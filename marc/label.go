@@ -0,0 +1,150 @@
+package marc
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type RecordLabel struct {
+	Length             int
+	Status             byte
+	Type               byte
+	BibLevel           byte
+	HierarchicalLevel  byte
+	Coding             byte
+	IndicatorLength    int
+	SubfieldCodeLength int
+	DataStart          int
+	EncodingLevel      byte
+	CatalogingForm     byte
+	LinkedRecord       byte
+	LengthOfLength     int
+	LengthOfStart      int
+	LengthOfImpl       int
+	Undefined          byte
+}
+
+type LabelError struct {
+	Field  string
+	Reason string
+}
+
+func (e *LabelError) Error() string {
+	return fmt.Sprintf("MARC label %s: %s", e.Field, e.Reason)
+}
+
+type DictError struct {
+	Tag    int
+	Start  int
+	Length int
+	Reason string
+}
+
+func (e *DictError) Error() string {
+	return fmt.Sprintf("MARC directory entry %03d (start %d, length %d): %s", e.Tag, e.Start, e.Length, e.Reason)
+}
+
+// parseDigits 解析只由 ASCII 数字组成的非负整数，strconv.Atoi 接受的符号等视为无效
+func parseDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	v, err := strconv.Atoi(string(b))
+	return v, err == nil
+}
+
+func labelInt(line []byte, start int, end int, name string) (int, error) {
+	v, ok := parseDigits(line[start:end])
+	if !ok {
+		return 0, &LabelError{name, fmt.Sprintf("invalid number %q", line[start:end])}
+	}
+	return v, nil
+}
+
+// ParseLabel 解析 24 字节的记录头标区
+func ParseLabel(line []byte) (label *RecordLabel, err error) {
+	if len(line) < labelLen {
+		return nil, &LabelError{"length", fmt.Sprintf("label too short (%d bytes)", len(line))}
+	}
+	label = &RecordLabel{
+		Status:            line[5],
+		Type:              line[6],
+		BibLevel:          line[7],
+		HierarchicalLevel: line[8],
+		Coding:            line[9],
+		EncodingLevel:     line[17],
+		CatalogingForm:    line[18],
+		LinkedRecord:      line[19],
+		Undefined:         line[23],
+	}
+	ints := []struct {
+		v          *int
+		start, end int
+		name       string
+	}{
+		{&label.Length, 0, 5, "record length"},
+		{&label.IndicatorLength, 10, 11, "indicator length"},
+		{&label.SubfieldCodeLength, 11, 12, "subfield code length"},
+		{&label.DataStart, 12, 17, "base address"},
+		{&label.LengthOfLength, 20, 21, "length of field length"},
+		{&label.LengthOfStart, 21, 22, "length of starting position"},
+		{&label.LengthOfImpl, 22, 23, "length of implementation part"},
+	}
+	for _, i := range ints {
+		*i.v, err = labelInt(line, i.start, i.end, i.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if label.IndicatorLength != 2 {
+		return nil, &LabelError{"indicator length", fmt.Sprintf("unsupported %d", label.IndicatorLength)}
+	}
+	if label.SubfieldCodeLength != 2 {
+		return nil, &LabelError{"subfield code length", fmt.Sprintf("unsupported %d", label.SubfieldCodeLength)}
+	}
+	if label.LengthOfLength == 0 || label.LengthOfStart == 0 {
+		return nil, &LabelError{"entry map", fmt.Sprintf("invalid %q", line[20:24])}
+	}
+	return label, nil
+}
+
+func (l *RecordLabel) entryLen() int {
+	return 3 + l.LengthOfLength + l.LengthOfStart + l.LengthOfImpl
+}
+
+// Bytes 将记录头标区编码为 24 字节
+func (l *RecordLabel) Bytes() []byte {
+	return []byte(fmt.Sprintf("%05d%c%c%c%c%c%d%d%05d%c%c%c%d%d%d%c",
+		l.Length, l.Status, l.Type, l.BibLevel, l.HierarchicalLevel, l.Coding,
+		l.IndicatorLength, l.SubfieldCodeLength, l.DataStart,
+		l.EncodingLevel, l.CatalogingForm, l.LinkedRecord,
+		l.LengthOfLength, l.LengthOfStart, l.LengthOfImpl, l.Undefined))
+}
+
+// validate 校验头标区与目次区、数据区是否一致
+func (l *RecordLabel) validate(line []byte, dict []*RecordDict, ds int) error {
+	if l.Length != len(line) {
+		return &LabelError{"record length", fmt.Sprintf("label says %d, record has %d bytes", l.Length, len(line))}
+	}
+	if l.DataStart != ds {
+		return &LabelError{"base address", fmt.Sprintf("label says %d, directory ends at %d", l.DataStart, ds)}
+	}
+	dl := len(line) - ds
+	for _, d := range dict {
+		if d.FieldStart < 0 || d.Length < 1 {
+			return &DictError{d.Tag, d.FieldStart, d.Length, "invalid start or length"}
+		}
+		if d.FieldStart+d.Length > dl {
+			return &DictError{d.Tag, d.FieldStart, d.Length, fmt.Sprintf("exceeds data length %d", dl)}
+		}
+		if d.Length == 0 || line[ds+d.FieldStart+d.Length-1] != fieldSeparator {
+			return &DictError{d.Tag, d.FieldStart, d.Length, "field not terminated by field separator"}
+		}
+	}
+	return nil
+}
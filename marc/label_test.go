@@ -0,0 +1,61 @@
+package marc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testLine() []byte {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, false)
+	check(w.Write(testRecord()))
+	check(w.Flush())
+	return buf.Bytes()
+}
+
+func TestParseLabel(t *testing.T) {
+	line := testLine()
+	l, err := ParseLabel(line)
+	check(err)
+	if l.Length != len(line) || l.Status != 'n' || l.Type != 'a' || l.BibLevel != 'm' {
+		t.Errorf("unexpected label %+v", l)
+	}
+	if l.IndicatorLength != 2 || l.SubfieldCodeLength != 2 || l.entryLen() != 12 {
+		t.Errorf("unexpected label %+v", l)
+	}
+	if string(l.Bytes()) != string(line[:labelLen]) {
+		t.Errorf("label bytes %q, want %q", l.Bytes(), line[:labelLen])
+	}
+}
+
+func TestValidateLabel(t *testing.T) {
+	r := &Reader{}
+	line := testLine()
+	copy(line[0:5], "00010")
+	if _, err := r.parse(line); err == nil {
+		t.Error("expect record length error")
+	} else if e, ok := err.(*LabelError); !ok || e.Field != "record length" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	line = testLine()
+	copy(line[12:17], "00025")
+	if _, err := r.parse(line); err == nil {
+		t.Error("expect base address error")
+	} else if e, ok := err.(*LabelError); !ok || e.Field != "base address" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	line = testLine()
+	copy(line[labelLen+3:labelLen+7], "0099")
+	if _, err := r.parse(line); err == nil {
+		t.Error("expect directory error")
+	} else if _, ok := err.(*DictError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	line = testLine()
+	if _, err := r.parse(line[:40]); err == nil {
+		t.Error("expect truncated directory error")
+	}
+}
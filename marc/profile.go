@@ -0,0 +1,197 @@
+package marc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// FieldMapping 描述从哪个字段、子字段取值，Subfield 为空时取全部子字段，
+// Start、End 按字符截取(End 为 0 表示到结尾)，Trim 为需去掉的尾部标点
+type FieldMapping struct {
+	Field      string `json:"field"`
+	Tag        int    `json:"tag"`
+	Subfield   string `json:"subfield,omitempty"`
+	Start      int    `json:"start,omitempty"`
+	End        int    `json:"end,omitempty"`
+	Trim       string `json:"trim,omitempty"`
+	Repeatable bool   `json:"repeatable,omitempty"`
+	Required   bool   `json:"required,omitempty"`
+}
+
+type Profile struct {
+	Name     string          `json:"name"`
+	Mappings []*FieldMapping `json:"mappings"`
+}
+
+var CNMARC = &Profile{
+	Name: "cnmarc",
+	Mappings: []*FieldMapping{
+		&FieldMapping{Field: "year", Tag: 100, Subfield: "a", Start: 9, End: 13, Required: true},
+		&FieldMapping{Field: "name", Tag: 200, Subfield: "a", Required: true},
+		&FieldMapping{Field: "terms", Tag: 606, Repeatable: true, Required: true},
+		&FieldMapping{Field: "keyword", Tag: 606, Subfield: "a"},
+		&FieldMapping{Field: "desc", Tag: 330, Subfield: "a"},
+		&FieldMapping{Field: "author", Tag: 701, Subfield: "a", Repeatable: true},
+		&FieldMapping{Field: "url", Tag: 856, Subfield: "u"},
+	},
+}
+
+var MARC21 = &Profile{
+	Name: "marc21",
+	Mappings: []*FieldMapping{
+		&FieldMapping{Field: "year", Tag: 8, Start: 7, End: 11, Required: true},
+		&FieldMapping{Field: "name", Tag: 245, Subfield: "a", Trim: " /:;,=.", Required: true},
+		&FieldMapping{Field: "terms", Tag: 650, Trim: " ,.", Repeatable: true, Required: true},
+		&FieldMapping{Field: "keyword", Tag: 650, Subfield: "a", Trim: " ,."},
+		&FieldMapping{Field: "desc", Tag: 520, Subfield: "a"},
+		&FieldMapping{Field: "author", Tag: 100, Subfield: "a", Trim: " ,.", Repeatable: true},
+		&FieldMapping{Field: "author", Tag: 700, Subfield: "a", Trim: " ,.", Repeatable: true},
+		&FieldMapping{Field: "url", Tag: 856, Subfield: "u"},
+	},
+}
+
+var profiles = []*Profile{CNMARC, MARC21}
+
+func GetProfile(name string) (*Profile, bool) {
+	for _, p := range profiles {
+		if p.Name == strings.ToLower(name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// DetectProfile 根据字段判断记录是 CNMARC 还是 MARC 21
+func DetectProfile(r *Record) *Profile {
+	tags := make([]int, len(r.Field))
+	for i, f := range r.Field {
+		tags[i] = f.Header
+	}
+	if isMARC21(tags) {
+		return MARC21
+	}
+	return CNMARC
+}
+
+// isMARC21 只有 245 题名时为 MARC 21，只有 200 题名时为 CNMARC，都有或都没有时看是否有 008 定长字段。
+// 100 在 CNMARC 中为通用处理数据，在 MARC 21 中为主要款目，不作为依据
+func isMARC21(tags []int) bool {
+	has := map[int]bool{}
+	for _, t := range tags {
+		has[t] = true
+	}
+	if has[200] != has[245] {
+		return has[245]
+	}
+	return has[8]
+}
+
+func (m *FieldMapping) values(f *RecordField) []string {
+	res := []string{}
+	if f.IsControl() {
+		res = append(res, f.Data())
+	} else if m.Subfield == "" {
+		res = f.SubfieldValues()
+	} else {
+		res = f.SubfieldAll(m.Subfield[0])
+	}
+	for i, v := range res {
+		res[i] = m.cut(v)
+	}
+	return res
+}
+
+func (m *FieldMapping) cut(v string) string {
+	if m.Start > 0 || m.End > 0 {
+		r := []rune(v)
+		end := m.End
+		if end == 0 {
+			end = len(r)
+		}
+		if m.Start >= len(r) || end > len(r) || m.Start > end {
+			return ""
+		}
+		v = string(r[m.Start:end])
+	}
+	if m.Trim != "" {
+		v = strings.TrimRight(v, m.Trim)
+	}
+	return v
+}
+
+// Extract 按映射提取记录中的值，不可重复的字段只取第一个非空值
+func (p *Profile) Extract(r *Record) map[string][]string {
+	res := map[string][]string{}
+	for k, groups := range p.ExtractGroups(r) {
+		for _, g := range groups {
+			res[k] = append(res[k], g...)
+		}
+	}
+	return res
+}
+
+// ExtractGroups 与 Extract 相同，但同一个字段(如一条 606 主题词串)中的值分为一组
+func (p *Profile) ExtractGroups(r *Record) map[string][][]string {
+	res := map[string][][]string{}
+	for _, m := range p.Mappings {
+		if !m.Repeatable && len(res[m.Field]) > 0 {
+			continue
+		}
+		for _, f := range r.Fields(m.Tag) {
+			g := []string{}
+			for _, v := range m.values(f) {
+				if v == "" {
+					continue
+				}
+				g = append(g, v)
+				if !m.Repeatable {
+					break
+				}
+			}
+			if len(g) > 0 {
+				res[m.Field] = append(res[m.Field], g)
+				if !m.Repeatable {
+					break
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Missing 返回 values 中缺少的必备字段
+func (p *Profile) Missing(values map[string][]string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, m := range p.Mappings {
+		if m.Required && len(values[m.Field]) == 0 && !seen[m.Field] {
+			res = append(res, m.Field)
+			seen[m.Field] = true
+		}
+	}
+	return res
+}
+
+// LoadProfile 从 JSON 文件读取字段映射
+func LoadProfile(path string) (*Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	err = json.Unmarshal(b, p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if p.Name == "" {
+		p.Name = path
+	}
+	for i, m := range p.Mappings {
+		if m.Field == "" || m.Tag < 0 || m.Tag > 999 || len(m.Subfield) > 1 || m.Start < 0 || m.End < 0 {
+			return nil, fmt.Errorf("%s: invalid mapping #%d %+v", path, i+1, *m)
+		}
+	}
+	return p, nil
+}
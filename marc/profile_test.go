@@ -0,0 +1,85 @@
+package marc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	cn := testRecord()
+	if p := DetectProfile(cn); p != CNMARC {
+		t.Fatalf("detect %s, want cnmarc", p.Name)
+	}
+	v := CNMARC.Extract(cn)
+	want := map[string][]string{
+		"year":    []string{"2014"},
+		"name":    []string{"北京历史"},
+		"terms":   []string{"北京", "历史", "近代"},
+		"keyword": []string{"北京"},
+		"author":  []string{"张三"},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("cnmarc %v, want %v", v, want)
+	}
+	// 每条主题词串为一组
+	two := testRecord()
+	two.Field = append(two.Field, NewRecordField(606, "0 \x1fa中国\x1fx近代史"))
+	groups := CNMARC.ExtractGroups(two)
+	wantGroups := [][]string{{"北京", "历史", "近代"}, {"中国", "近代史"}}
+	if !reflect.DeepEqual(groups["terms"], wantGroups) {
+		t.Errorf("terms groups %v, want %v", groups["terms"], wantGroups)
+	}
+	if g := groups["keyword"]; !reflect.DeepEqual(g, [][]string{{"北京"}}) {
+		t.Errorf("keyword groups %v", g)
+	}
+
+	us := &Record{Field: []*RecordField{
+		NewRecordField(8, "150101s2014    cc            000 0 chi d"),
+		NewRecordField(100, "1 \x1faZhang, San,\x1fd1950-"),
+		NewRecordField(245, "10\x1faBeijing history /\x1fcZhang San."),
+		NewRecordField(650, " 0\x1faBeijing (China)\x1fxHistory."),
+		NewRecordField(700, "1 \x1faLi, Si."),
+	}}
+	if p := DetectProfile(us); p != MARC21 {
+		t.Fatalf("detect %s, want marc21", p.Name)
+	}
+	// 没有 008 时 100 不能作为 CNMARC 的依据
+	noFixed := &Record{Field: us.Field[1:]}
+	if p := DetectProfile(noFixed); p != MARC21 {
+		t.Errorf("detect %s without 008, want marc21", p.Name)
+	}
+	v = MARC21.Extract(us)
+	want = map[string][]string{
+		"year":    []string{"2014"},
+		"name":    []string{"Beijing history"},
+		"terms":   []string{"Beijing (China)", "History"},
+		"keyword": []string{"Beijing (China)"},
+		"author":  []string{"Zhang, San", "Li, Si"},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("marc21 %v, want %v", v, want)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	p, err := LoadProfile("../mapping.example.json")
+	check(err)
+	rc := testRecord()
+	rc.Field = append(rc.Field,
+		NewRecordField(10, "  \x1fa978-7-02-000000-1\x1fdCNY30.00"),
+		NewRecordField(210, "  \x1fa北京\x1fc人民出版社\x1fd2014"))
+	v := p.Extract(rc)
+	if first := v["publisher"]; len(first) != 1 || first[0] != "人民出版社" {
+		t.Errorf("publisher %v", v["publisher"])
+	}
+	if isbn := v["isbn"]; len(isbn) != 1 || isbn[0] != "978-7-02-000000-1" {
+		t.Errorf("isbn %v", v["isbn"])
+	}
+	if m := p.Missing(v); len(m) != 0 {
+		t.Errorf("missing %v", m)
+	}
+	delete(v, "terms")
+	if m := p.Missing(v); !reflect.DeepEqual(m, []string{"terms"}) {
+		t.Errorf("missing %v", m)
+	}
+}
@@ -5,11 +5,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"golang.org/x/text/encoding/simplifiedchinese"
-	"golang.org/x/text/transform"
 	"io"
-	"io/ioutil"
-	"strconv"
 )
 
 const (
@@ -27,10 +23,16 @@ var (
 )
 
 type Reader struct {
-	line    int
-	r       *bufio.Reader
-	skip    int
-	chinese bool
+	line   int
+	r      *bufio.Reader
+	skip   int
+	enc    Encoding
+	guess  Encoding
+	mode   Mode
+	offset int64
+	start  int64
+	errs   []*ParseError
+	count  int
 }
 
 type Record struct {
@@ -38,11 +40,8 @@ type Record struct {
 	Dict  []*RecordDict
 	Field []*RecordField
 	Orig  string
-}
-
-type RecordLabel struct {
-	Length    int
-	dataStart int
+	// Encoding 为解析该记录时使用的编码
+	Encoding Encoding
 }
 
 type RecordDict struct {
@@ -51,11 +50,6 @@ type RecordDict struct {
 	FieldStart int
 }
 
-type RecordField struct {
-	Header int
-	Value  string
-}
-
 func ParseSubfield(field string, start int32) string {
 	r := []rune(field)
 	l := len(r)
@@ -122,34 +116,71 @@ func ParseAllSubfield(field string) []string {
 }
 
 func NewReader(r io.Reader, skip int, chinese bool) *Reader {
+	enc := UTF8
+	if chinese {
+		enc = GB18030
+	}
 	return &Reader{
-		r:       bufio.NewReaderSize(r, maxLen),
-		skip:    skip,
-		chinese: chinese,
+		r:     bufio.NewReaderSize(r, maxLen),
+		skip:  skip,
+		enc:   enc,
+		guess: GB18030,
 	}
 }
 
+// SetEncoding 指定记录编码，Auto 表示逐条记录自动检测
+func (r *Reader) SetEncoding(enc Encoding) {
+	r.enc = enc
+}
+
+// SetMode 设置解析模式，Lenient 模式下跳过错误记录并记录 ParseError
+func (r *Reader) SetMode(mode Mode) {
+	r.mode = mode
+}
+
 func (r *Reader) Read() (record *Record, err error) {
 	for {
 		record, err = r.parseRecord()
 		if record != nil {
+			r.count++
 			break
 		}
-		if err != nil {
+		if err == io.EOF {
 			return nil, err
 		}
+		if err != nil {
+			pe := newParseError(r.line, r.start, err)
+			if r.mode == Strict {
+				return nil, pe
+			}
+			r.errs = append(r.errs, pe)
+		}
 	}
 	return record, nil
 }
 
+func (r *Reader) Errors() []*ParseError {
+	return r.errs
+}
+
+func (r *Reader) Report() *ParseReport {
+	return &ParseReport{r.count, r.errs}
+}
+
 func (r *Reader) readLine() (line []byte, err error) {
+	r.start = r.offset
 	line, err = r.r.ReadBytes(recordSeparator)
+	r.offset += int64(len(line))
+	if err == io.EOF && len(bytes.TrimSpace(line)) > 0 {
+		return nil, ErrTruncated
+	}
 	if err != nil {
 		return nil, err
 	}
 	if r.skip > 0 {
-		_, err = r.r.Discard(r.skip)
-		if err != nil {
+		n, err := r.r.Discard(r.skip)
+		r.offset += int64(n)
+		if err != nil && err != io.EOF {
 			return nil, err
 		}
 	}
@@ -158,6 +189,7 @@ func (r *Reader) readLine() (line []byte, err error) {
 			if i == 0 {
 				break
 			}
+			r.start += int64(i)
 			return line[i:], nil
 		}
 	}
@@ -179,16 +211,16 @@ func (r *Reader) readRecord() (record *Record, err error) {
 		if len(other) != ol {
 			return nil, ErrMarc
 		}*/
-	record.Orig, _ = decode(line, r.chinese)
+	record.Orig, _ = decode(line, r.enc)
 	if err != nil {
 		return nil, err
 	}
 	ds := 0
-	record.Dict, ds, err = r.parseDict(line)
+	record.Dict, ds, err = r.parseDict(record.Label, line)
 	if err != nil {
 		return nil, err
 	}
-	record.Field, err = r.parseField(record.Dict, line[ds:len(line)])
+	record.Field, err = r.parseField(record.Dict, line[ds:len(line)], r.enc)
 	if err != nil {
 		return nil, err
 	}
@@ -197,73 +229,87 @@ func (r *Reader) readRecord() (record *Record, err error) {
 
 func (r *Reader) parseRecord() (record *Record, err error) {
 	r.line++
-	record = &Record{}
 	line, err := r.readLine()
 	if err != nil {
 		return nil, err
 	}
-	record.Orig, _ = decode(line, r.chinese)
+	return r.parse(line)
+}
+
+func (r *Reader) parse(line []byte) (record *Record, err error) {
+	record = &Record{}
 	record.Label, err = r.parseLabel(line)
 	if err != nil {
 		return nil, err
 	}
 	ds := 0
-	record.Dict, ds, err = r.parseDict(line)
+	record.Dict, ds, err = r.parseDict(record.Label, line)
 	if err != nil {
 		return nil, err
 	}
-	record.Field, err = r.parseField(record.Dict, line[ds:])
+	err = record.Label.validate(line, record.Dict, ds)
+	if err != nil {
+		return nil, err
+	}
+	record.Encoding = r.detect(line, record.Label, record.Dict, ds)
+	record.Orig, _ = decode(line, record.Encoding)
+	record.Field, err = r.parseField(record.Dict, line[ds:], record.Encoding)
 	if err != nil {
 		return nil, err
 	}
 	return record, nil
 }
 
-func (r *Reader) parseField(dict []*RecordDict, line []byte) (field []*RecordField, err error) {
+func (r *Reader) detect(line []byte, label *RecordLabel, dict []*RecordDict, ds int) Encoding {
+	if r.enc != Auto {
+		return r.enc
+	}
+	// 优先采用记录中的编码标识；标为 MARC-8 的记录只有内容是合法的 UTF-8 时才不采用，
+	// 不含 ESC 的 ANSEL 字符无法从字节分布判断
+	if enc, ok := encodingHint(line, label, dict, ds); ok {
+		if d := DetectEncoding(line, enc); d == enc || enc == MARC8 && d != UTF8 {
+			return enc
+		}
+	}
+	enc := DetectEncoding(line, r.guess)
+	if enc == GB18030 || enc == Big5 {
+		r.guess = enc
+	}
+	return enc
+}
+
+func (r *Reader) parseField(dict []*RecordDict, line []byte, enc Encoding) (field []*RecordField, err error) {
 	for _, d := range dict {
 		f := line[d.FieldStart : d.FieldStart+d.Length]
-		s, err := decode(f, r.chinese)
+		s, err := decode(f, enc)
 		if err != nil {
-			return nil, err
+			return nil, &FieldError{d.Tag, err}
 		}
-		field = append(field, &RecordField{d.Tag, s})
+		field = append(field, NewRecordField(d.Tag, s))
 	}
 	return field, nil
 }
 
-func decode(field []byte, chinese bool) (s string, err error) {
-	if !chinese {
-		return string(field), nil
-	}
-	i := bytes.NewReader(field)
-	o := transform.NewReader(i, simplifiedchinese.GB18030.NewDecoder())
-	d, err := ioutil.ReadAll(o)
-	if err != nil {
-		return "", err
-	}
-	return string(d), nil
-}
-
-func (r *Reader) parseDict(line []byte) (dict []*RecordDict, ds int, err error) {
-	i := 24
+func (r *Reader) parseDict(label *RecordLabel, line []byte) (dict []*RecordDict, ds int, err error) {
+	i := labelLen
+	el, ls := label.entryLen(), 3+label.LengthOfLength
 	for {
+		if i >= len(line) {
+			return nil, i, &LabelError{"directory", "missing field separator"}
+		}
 		if line[i] == fieldSeparator {
 			i++
 			break
 		}
-		t, l, s := string(line[i:i+3]), string(line[i+3:i+7]), string(line[i+7:i+12])
-		i += 12
-		ti, err := strconv.Atoi(t)
-		if err != nil {
-			return nil, i, err
-		}
-		li, err := strconv.Atoi(l)
-		if err != nil {
-			return nil, i, err
+		if i+el > len(line) {
+			return nil, i, &LabelError{"directory", fmt.Sprintf("truncated entry at %d", i)}
 		}
-		si, err := strconv.Atoi(s)
-		if err != nil {
-			return nil, i, err
+		ti, ok1 := parseDigits(line[i : i+3])
+		li, ok2 := parseDigits(line[i+3 : i+ls])
+		si, ok3 := parseDigits(line[i+ls : i+ls+label.LengthOfStart])
+		i += el
+		if !ok1 || !ok2 || !ok3 {
+			return nil, i, &LabelError{"directory", fmt.Sprintf("invalid entry %q at %d", line[i-el:i], i-el)}
 		}
 		dict = append(dict, &RecordDict{ti, li, si})
 	}
@@ -285,15 +331,5 @@ func (r *Reader) readLabel() (label *RecordLabel, err error) {
 }
 
 func (r *Reader) parseLabel(line []byte) (label *RecordLabel, err error) {
-	label = &RecordLabel{}
-	label.Length, err = strconv.Atoi(string(line[:5]))
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println("record length: ", label.Length)
-	label.dataStart, err = strconv.Atoi(string(line[12:17]))
-	if err != nil {
-		return nil, err
-	}
-	return label, err
+	return ParseLabel(line)
 }
@@ -0,0 +1,102 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	labelLen     = 24
+	dictEntryLen = 12
+	defaultLabel = "00000nam  2200000   450 "
+)
+
+var (
+	ErrTooLong = errors.New("MARC record too long")
+)
+
+type Writer struct {
+	w       *bufio.Writer
+	chinese bool
+}
+
+func NewWriter(w io.Writer, chinese bool) *Writer {
+	return &Writer{
+		w:       bufio.NewWriterSize(w, maxLen),
+		chinese: chinese,
+	}
+}
+
+func (w *Writer) Write(record *Record) error {
+	b, err := w.marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(b)
+	return err
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) marshal(record *Record) ([]byte, error) {
+	dict := bytes.Buffer{}
+	data := bytes.Buffer{}
+	for _, f := range record.Field {
+		v, err := encode(f.data(), w.chinese)
+		if err != nil {
+			return nil, err
+		}
+		if len(v) == 0 || v[len(v)-1] != fieldSeparator {
+			v = append(v, fieldSeparator)
+		}
+		if f.Header < 0 || f.Header > 999 || len(v) > 9999 || data.Len() > 99999 {
+			return nil, ErrTooLong
+		}
+		fmt.Fprintf(&dict, "%03d%04d%05d", f.Header, len(v), data.Len())
+		data.Write(v)
+	}
+	dict.WriteByte(fieldSeparator)
+	dataStart := labelLen + dict.Len()
+	length := dataStart + data.Len() + 1
+	if length > maxLen {
+		return nil, ErrTooLong
+	}
+	label := []byte(defaultLabel)
+	if record.Label != nil {
+		copy(label, record.Label.Bytes())
+	} else if len(record.Orig) >= labelLen {
+		copy(label, record.Orig[:labelLen])
+	}
+	// 09 位按写出的编码设置，a 为 Unicode，GB18030 为空格(非 Unicode)
+	label[9] = 'a'
+	if w.chinese {
+		label[9] = ' '
+	}
+	copy(label[0:5], fmt.Sprintf("%05d", length))
+	copy(label[10:12], "22")
+	copy(label[12:17], fmt.Sprintf("%05d", dataStart))
+	copy(label[20:23], "450")
+	res := make([]byte, 0, length)
+	res = append(res, label...)
+	res = append(res, dict.Bytes()...)
+	res = append(res, data.Bytes()...)
+	res = append(res, recordSeparator)
+	return res, nil
+}
+
+func encode(s string, chinese bool) ([]byte, error) {
+	if !chinese {
+		return []byte(s), nil
+	}
+	i := bytes.NewReader([]byte(s))
+	o := transform.NewReader(i, simplifiedchinese.GB18030.NewEncoder())
+	return ioutil.ReadAll(o)
+}
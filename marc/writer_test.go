@@ -0,0 +1,129 @@
+package marc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testRecord() *Record {
+	return &Record{
+		Field: []*RecordField{
+			NewRecordField(1, "012000000001"),
+			NewRecordField(100, "  \x1fa20150101d2014    em y0chiy0110    ea"),
+			NewRecordField(200, "1 \x1fa北京历史\x1fb专著\x1ff张三著"),
+			NewRecordField(606, "0 \x1fa北京\x1fx历史\x1fy近代"),
+			NewRecordField(701, " 0\x1fa张三\x1f4著"),
+		},
+	}
+}
+
+func testWriteRead(t *testing.T, chinese bool) {
+	rc := testRecord()
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, chinese)
+	check(w.Write(rc))
+	check(w.Write(rc))
+	check(w.Flush())
+	r := NewReader(buf, 0, chinese)
+	for n := 0; n < 2; n++ {
+		res, err := r.Read()
+		check(err)
+		if res.Label.Length != len(res.Orig) && !chinese {
+			t.Errorf("record length %d, want %d", res.Label.Length, len(res.Orig))
+		}
+		if len(res.Field) != len(rc.Field) {
+			t.Fatalf("field count %d, want %d", len(res.Field), len(rc.Field))
+		}
+		for i, f := range res.Field {
+			if f.Header != rc.Field[i].Header || f.Value != rc.Field[i].Value+"\x1e" {
+				t.Errorf("field %d: %d %q, want %d %q", i, f.Header, f.Value, rc.Field[i].Header, rc.Field[i].Value)
+			}
+		}
+	}
+}
+
+func TestWriteUtf8(t *testing.T) {
+	testWriteRead(t, false)
+}
+
+func TestWriteGB18030(t *testing.T) {
+	testWriteRead(t, true)
+}
+
+// 修改子字段后 ISO 2709 与 MARCXML 写出的内容一致
+func TestWriteEditedSubfield(t *testing.T) {
+	rc := testRecord()
+	f := rc.Field[3]
+	f.Ind2 = '1'
+	f.Subfields[1].Value = "地方史"
+	f.Subfields = append(f.Subfields, &Subfield{'z', "北京"})
+	want := "01\x1fa北京\x1fx地方史\x1fy近代\x1fz北京\x1e"
+
+	iso := &bytes.Buffer{}
+	w := NewWriter(iso, false)
+	check(w.Write(rc))
+	check(w.Flush())
+	res, err := NewReader(iso, 0, false).Read()
+	check(err)
+	if v := res.Field[3].Value; v != want {
+		t.Errorf("iso: %q, want %q", v, want)
+	}
+
+	xb := &bytes.Buffer{}
+	xw := NewXMLWriter(xb)
+	check(xw.Write(res))
+	check(xw.Close())
+	res, err = NewXMLReader(xb).Read()
+	check(err)
+	if v := res.Field[3].Value; v != want {
+		t.Errorf("xml: %q, want %q", v, want)
+	}
+
+	res.Field[3].Subfields[0].Value = "上海"
+	iso.Reset()
+	w = NewWriter(iso, false)
+	check(w.Write(res))
+	check(w.Flush())
+	res, err = NewReader(iso, 0, false).Read()
+	check(err)
+	if v := res.Field[3].Subfield('a'); v != "上海" {
+		t.Errorf("xml to iso: %q, want 上海", v)
+	}
+}
+
+func TestWriteCoding(t *testing.T) {
+	cases := []struct {
+		orig    string
+		chinese bool
+		want    byte
+	}{
+		{"00000nam  2200000   450 ", false, 'a'},
+		{"00000nam a2200000   450 ", true, ' '},
+		{"00000nam a2200000   450 ", false, 'a'},
+	}
+	for i, c := range cases {
+		rc := testRecord()
+		rc.Orig = c.orig
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf, c.chinese)
+		check(w.Write(rc))
+		check(w.Flush())
+		res, err := NewReader(buf, 0, c.chinese).Read()
+		check(err)
+		if res.Label.Coding != c.want {
+			t.Errorf("case %d: coding %q, want %q", i, res.Label.Coding, c.want)
+		}
+	}
+	// MARCXML 总是 UTF-8
+	rc := testRecord()
+	rc.Orig = "00000nam  2200000   450 "
+	buf := &bytes.Buffer{}
+	xw := NewXMLWriter(buf)
+	check(xw.Write(rc))
+	check(xw.Close())
+	res, err := NewXMLReader(buf).Read()
+	check(err)
+	if res.Label.Coding != 'a' {
+		t.Errorf("xml coding %q, want 'a'", res.Label.Coding)
+	}
+}
@@ -0,0 +1,254 @@
+package marc
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding/htmlindex"
+	"io"
+)
+
+const (
+	xmlNamespace = "http://www.loc.gov/MARC21/slim"
+)
+
+type xmlRecord struct {
+	XMLName      xml.Name          `xml:"record"`
+	Leader       string            `xml:"leader"`
+	ControlField []xmlControlField `xml:"controlfield"`
+	DataField    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag      string        `xml:"tag,attr"`
+	Ind1     string        `xml:"ind1,attr"`
+	Ind2     string        `xml:"ind2,attr"`
+	Subfield []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type XMLReader struct {
+	line  int
+	d     *xml.Decoder
+	mode  Mode
+	errs  []*ParseError
+	count int
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		e, err := htmlindex.Get(label)
+		if err != nil {
+			return nil, err
+		}
+		return e.NewDecoder().Reader(input), nil
+	}
+	return &XMLReader{d: d}
+}
+
+func (r *XMLReader) SetMode(mode Mode) {
+	r.mode = mode
+}
+
+func (r *XMLReader) Read() (record *Record, err error) {
+	for {
+		start := r.d.InputOffset()
+		t, err := r.d.Token()
+		if err != nil {
+			return nil, err
+		}
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != "record" {
+			continue
+		}
+		r.line++
+		xr := &xmlRecord{}
+		err = r.d.DecodeElement(xr, &se)
+		if err != nil {
+			return nil, newParseError(r.line, start, err)
+		}
+		record, err = r.convert(xr)
+		if err == nil {
+			r.count++
+			return record, nil
+		}
+		pe := newParseError(r.line, start, err)
+		if r.mode == Strict {
+			return nil, pe
+		}
+		r.errs = append(r.errs, pe)
+	}
+}
+
+func (r *XMLReader) Errors() []*ParseError {
+	return r.errs
+}
+
+func (r *XMLReader) Report() *ParseReport {
+	return &ParseReport{r.count, r.errs}
+}
+
+// convert 直接由 XML 元素生成记录，只校验头标区。记录长度和数据起始地址在 MARCXML 中没有意义，按 0 处理
+func (r *XMLReader) convert(xr *xmlRecord) (*Record, error) {
+	leader := []byte(xr.Leader)
+	if len(leader) >= labelLen {
+		leader = leader[:labelLen]
+		copy(leader[0:5], "00000")
+		copy(leader[12:17], "00000")
+	}
+	label, err := ParseLabel(leader)
+	if err != nil {
+		return nil, err
+	}
+	rc := &Record{Label: label, Orig: string(leader), Encoding: UTF8}
+	for _, c := range xr.ControlField {
+		tag, err := xmlTag(c.Tag)
+		if err != nil {
+			return nil, err
+		}
+		rc.Field = append(rc.Field, &RecordField{Header: tag, Value: c.Value + string(fieldSeparator)})
+	}
+	for _, d := range xr.DataField {
+		tag, err := xmlTag(d.Tag)
+		if err != nil {
+			return nil, err
+		}
+		f := &RecordField{Header: tag, Ind1: indicator(d.Ind1), Ind2: indicator(d.Ind2)}
+		v := []byte{f.Ind1, f.Ind2}
+		for _, s := range d.Subfield {
+			if len(s.Code) != 1 {
+				return nil, &FieldError{tag, fmt.Errorf("invalid subfield code %q", s.Code)}
+			}
+			f.Subfields = append(f.Subfields, &Subfield{s.Code[0], s.Value})
+			v = append(v, subSeparator)
+			v = append(v, s.Code...)
+			v = append(v, s.Value...)
+		}
+		f.Value = string(append(v, fieldSeparator))
+		rc.Field = append(rc.Field, f)
+	}
+	return rc, nil
+}
+
+func xmlTag(s string) (int, error) {
+	tag, ok := parseDigits([]byte(s))
+	if !ok || len(s) != 3 {
+		return 0, fmt.Errorf("MARCXML invalid tag %q", s)
+	}
+	return tag, nil
+}
+
+func indicator(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+type XMLWriter struct {
+	e      *xml.Encoder
+	w      *Writer
+	header bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return &XMLWriter{
+		e: e,
+		w: &Writer{},
+	}
+}
+
+func (w *XMLWriter) Write(record *Record) error {
+	if !w.header {
+		err := w.start()
+		if err != nil {
+			return err
+		}
+	}
+	line, err := w.w.marshal(record)
+	if err != nil {
+		return err
+	}
+	xr := &xmlRecord{Leader: string(line[:labelLen])}
+	for _, f := range record.Field {
+		tag := fmt.Sprintf("%03d", f.Header)
+		if f.IsControl() {
+			xr.ControlField = append(xr.ControlField, xmlControlField{tag, f.Data()})
+			continue
+		}
+		df := xmlDataField{Tag: tag, Ind1: string(indicatorByte(f.Ind1)), Ind2: string(indicatorByte(f.Ind2))}
+		for _, s := range f.Subfields {
+			df.Subfield = append(df.Subfield, xmlSubfield{string(s.Code), s.Value})
+		}
+		xr.DataField = append(xr.DataField, df)
+	}
+	return w.e.Encode(xr)
+}
+
+func (w *XMLWriter) start() error {
+	w.header = true
+	err := w.e.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)})
+	if err != nil {
+		return err
+	}
+	return w.e.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: xmlNamespace}},
+	})
+}
+
+// Close 写入 collection 结束标签，不关闭底层的 io.Writer
+func (w *XMLWriter) Close() error {
+	if !w.header {
+		err := w.start()
+		if err != nil {
+			return err
+		}
+	}
+	err := w.e.EncodeToken(xml.EndElement{Name: xml.Name{Local: "collection"}})
+	if err != nil {
+		return err
+	}
+	return w.e.Flush()
+}
+
+type RecordReader interface {
+	Read() (*Record, error)
+	SetMode(mode Mode)
+	Errors() []*ParseError
+	Report() *ParseReport
+}
+
+// NewRecordReader 根据文件开头判断是 MARCXML 还是 ISO 2709 格式，
+// enc 只对 ISO 2709 有效，MARCXML 按 XML 声明的编码解析
+func NewRecordReader(r io.Reader, skip int, enc Encoding) RecordReader {
+	br := bufio.NewReaderSize(r, maxLen)
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err != nil || i > 64 {
+			break
+		}
+		c := b[i-1]
+		if c == '<' {
+			return NewXMLReader(br)
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != 0xef && c != 0xbb && c != 0xbf {
+			break
+		}
+	}
+	rd := NewReader(br, skip, false)
+	rd.SetEncoding(enc)
+	return rd
+}
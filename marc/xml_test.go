@@ -0,0 +1,98 @@
+package marc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXMLWriteRead(t *testing.T) {
+	rc := testRecord()
+	buf := &bytes.Buffer{}
+	w := NewXMLWriter(buf)
+	check(w.Write(rc))
+	check(w.Write(rc))
+	check(w.Close())
+	r := NewRecordReader(buf, 0, Auto)
+	if _, ok := r.(*XMLReader); !ok {
+		t.Fatal("MARCXML not detected")
+	}
+	for n := 0; n < 2; n++ {
+		res, err := r.Read()
+		check(err)
+		if len(res.Field) != len(rc.Field) {
+			t.Fatalf("field count %d, want %d", len(res.Field), len(rc.Field))
+		}
+		for i, f := range res.Field {
+			if f.Header != rc.Field[i].Header || f.Value != rc.Field[i].Value+"\x1e" {
+				t.Errorf("field %d: %d %q, want %d %q", i, f.Header, f.Value, rc.Field[i].Header, rc.Field[i].Value)
+			}
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expect EOF, got %v", err)
+	}
+}
+
+func TestXMLRead(t *testing.T) {
+	s := `<?xml version="1.0" encoding="UTF-8"?>
+<marc:collection xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:record>
+    <marc:leader>00000nam a2200000 a 4500</marc:leader>
+    <marc:controlfield tag="001">123</marc:controlfield>
+    <marc:datafield tag="245" ind1="1" ind2="0">
+      <marc:subfield code="a">Beijing :</marc:subfield>
+      <marc:subfield code="b">a history</marc:subfield>
+    </marc:datafield>
+  </marc:record>
+</marc:collection>`
+	r := NewRecordReader(strings.NewReader(s), 0, Auto)
+	rc, err := r.Read()
+	check(err)
+	if len(rc.Field) != 2 || rc.Field[1].Header != 245 {
+		t.Fatalf("unexpected fields %v", rc.Field)
+	}
+	if ParseSubfield(rc.Field[1].Value, 'b') != "a history" {
+		t.Errorf("subfield b: %q", ParseSubfield(rc.Field[1].Value, 'b'))
+	}
+	if rc.Label.Coding != 'a' || rc.Orig != "00000nam a2200000 a 4500" {
+		t.Errorf("unexpected label %q", rc.Orig)
+	}
+	f := rc.Field[1]
+	if f.Ind1 != '1' || f.Ind2 != '0' || len(f.Subfields) != 2 || f.Subfield('a') != "Beijing :" {
+		t.Errorf("unexpected field %+v", f)
+	}
+}
+
+// 超过 ISO 2709 记录长度上限的 MARCXML 记录也能读取
+func TestXMLReadLarge(t *testing.T) {
+	b := &bytes.Buffer{}
+	b.WriteString(`<collection><record><leader>     nam a22     3a 4500</leader>`)
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(b, `<datafield tag="606" ind1="0" ind2=" "><subfield code="a">%s</subfield></datafield>`, strings.Repeat("史", 20))
+	}
+	b.WriteString(`</record></collection>`)
+	rc, err := NewRecordReader(b, 0, Auto).Read()
+	check(err)
+	if len(rc.Field) != 2000 || rc.Field[1999].Subfield('a') != strings.Repeat("史", 20) {
+		t.Errorf("unexpected fields: %d", len(rc.Field))
+	}
+}
+
+func TestXMLReadInvalid(t *testing.T) {
+	cases := []string{
+		`<record><leader>00000nam a2200000 a</leader></record>`,
+		`<record><leader>00000nam a3200000 a 4500</leader></record>`,
+		`<record><leader>00000nam a2200000 a 4500</leader><controlfield tag="-01">1</controlfield></record>`,
+		`<record><leader>00000nam a2200000 a 4500</leader><datafield tag="245"><subfield code="ab">x</subfield></datafield></record>`,
+	}
+	for i, c := range cases {
+		r := NewRecordReader(strings.NewReader(c), 0, Auto)
+		r.SetMode(Strict)
+		if _, err := r.Read(); err == nil {
+			t.Errorf("case %d: expect error", i)
+		}
+	}
+}
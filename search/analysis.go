@@ -0,0 +1,261 @@
+package search
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Token 为分词结果，Position 为词在字段中的序号
+type Token struct {
+	Text     string
+	Position int
+}
+
+type Tokenizer interface {
+	Tokenize(s string) []*Token
+}
+
+type TokenFilter interface {
+	Filter(tokens []*Token) []*Token
+}
+
+// Analyzer 先用 Tokenizer 分词，再依次经过 Filters 处理
+type Analyzer struct {
+	Tokenizer Tokenizer
+	Filters   []TokenFilter
+}
+
+func NewAnalyzer(t Tokenizer, filters ...TokenFilter) *Analyzer {
+	return &Analyzer{t, filters}
+}
+
+func (a *Analyzer) Analyze(s string) []*Token {
+	tokens := a.Tokenizer.Tokenize(s)
+	for _, f := range a.Filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+// DefaultAnalyzer 中文按二元切分，繁体字转为简体字，拉丁字母转为小写
+var DefaultAnalyzer = NewAnalyzer(&BigramTokenizer{}, &LowercaseFilter{}, &SimplifiedFilter{})
+
+// KeywordAnalyzer 不切分，只将繁体字转为简体字，用于主题词等整词检索的字段
+var KeywordAnalyzer = NewAnalyzer(&KeywordTokenizer{}, &SimplifiedFilter{})
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// textRun 为连续的中日韩文字或字母数字
+type textRun struct {
+	text []rune
+	cjk  bool
+}
+
+// splitRuns 按标点、空白及文字种类切分文本
+func splitRuns(s string) []*textRun {
+	res := []*textRun{}
+	var cur *textRun
+	for _, r := range s {
+		cjk := isCJK(r)
+		if !cjk && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			cur = nil
+			continue
+		}
+		if cur == nil || cur.cjk != cjk {
+			cur = &textRun{cjk: cjk}
+			res = append(res, cur)
+		}
+		cur.text = append(cur.text, r)
+	}
+	return res
+}
+
+// BigramTokenizer 将连续的中日韩文字切分为相互重叠的二元词，
+// 只有一个字时作为一个词；字母数字按整词切分
+type BigramTokenizer struct{}
+
+func (t *BigramTokenizer) Tokenize(s string) []*Token {
+	res := []*Token{}
+	for _, run := range splitRuns(s) {
+		if !run.cjk || len(run.text) == 1 {
+			res = append(res, &Token{string(run.text), len(res)})
+			continue
+		}
+		for i := 0; i+1 < len(run.text); i++ {
+			res = append(res, &Token{string(run.text[i : i+2]), len(res)})
+		}
+	}
+	return res
+}
+
+// DictTokenizer 对中日韩文字按词典正向最大匹配切分，词典中没有的字单独成词；
+// 字母数字按整词切分
+type DictTokenizer struct {
+	words  map[string]bool
+	maxLen int
+}
+
+func NewDictTokenizer(words []string) *DictTokenizer {
+	t := &DictTokenizer{words: map[string]bool{}}
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		t.words[w] = true
+		if n := len([]rune(w)); n > t.maxLen {
+			t.maxLen = n
+		}
+	}
+	return t
+}
+
+// ReadDict 读取每行一个词的词典文件，忽略空行及 # 开头的行
+func ReadDict(r io.Reader) (*DictTokenizer, error) {
+	words := []string{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewDictTokenizer(words), nil
+}
+
+func (t *DictTokenizer) Tokenize(s string) []*Token {
+	res := []*Token{}
+	for _, run := range splitRuns(s) {
+		if !run.cjk {
+			res = append(res, &Token{string(run.text), len(res)})
+			continue
+		}
+		for i := 0; i < len(run.text); {
+			n := t.maxLen
+			if n > len(run.text)-i {
+				n = len(run.text) - i
+			}
+			for ; n > 1; n-- {
+				if t.words[string(run.text[i:i+n])] {
+					break
+				}
+			}
+			if n < 1 {
+				n = 1
+			}
+			res = append(res, &Token{string(run.text[i : i+n]), len(res)})
+			i += n
+		}
+	}
+	return res
+}
+
+// KeywordTokenizer 将去掉首尾空白的整个文本作为一个词
+type KeywordTokenizer struct{}
+
+func (t *KeywordTokenizer) Tokenize(s string) []*Token {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return []*Token{}
+	}
+	return []*Token{&Token{s, 0}}
+}
+
+// LowercaseFilter 将拉丁字母转为小写
+type LowercaseFilter struct{}
+
+func (f *LowercaseFilter) Filter(tokens []*Token) []*Token {
+	for _, t := range tokens {
+		t.Text = strings.ToLower(t.Text)
+	}
+	return tokens
+}
+
+// SimplifiedFilter 将繁体字转为简体字，使繁简两种写法能互相匹配
+type SimplifiedFilter struct{}
+
+func (f *SimplifiedFilter) Filter(tokens []*Token) []*Token {
+	for _, t := range tokens {
+		t.Text = toSimplified(t.Text)
+	}
+	return tokens
+}
+
+// analyzable 由可以分词的字段实现
+type analyzable interface {
+	analyze(a *Analyzer) []Term
+}
+
+// TextField 为需要分词的文本，Searcher 使用字段对应的 Analyzer 分词，
+// 未指定时使用 DefaultAnalyzer
+type TextField struct {
+	BaseField
+	Value string
+}
+
+func (f *TextField) Terms() []Term {
+	return f.analyze(DefaultAnalyzer)
+}
+
+func (f *TextField) analyze(a *Analyzer) []Term {
+	res := []Term{}
+	for _, t := range a.Analyze(f.Value) {
+		res = append(res, Term{f.Name, t.Text})
+	}
+	return res
+}
+
+func (f *TextField) GetValue() interface{} {
+	return f.Value
+}
+
+// SetAnalyzer 指定字段使用的 Analyzer，建索引及查询时都使用该 Analyzer，
+// 对 TextField 及 StrSliceField 有效，StrSliceField 的每个值分别分词。
+// 应在添加文档前设置；索引加载后需重新设置
+func (s *Searcher) SetAnalyzer(field string, a *Analyzer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.analyzers[field] = a
+	s.analyzed[field] = true
+}
+
+// normalize 对分词字段的值只经过 Analyzer 的 Filters 处理，不切分，
+// 用于前缀、通配符、模糊查询
+func (s *Searcher) normalize(field string, v string) string {
+	a := s.analyzer(field)
+	if a == nil {
+		return v
+	}
+	return a.normalize(v)
+}
+
+// normalize 只用过滤器处理整个值，不切分
+func (a *Analyzer) normalize(v string) string {
+	tokens := []*Token{&Token{v, 0}}
+	for _, f := range a.Filters {
+		tokens = f.Filter(tokens)
+	}
+	if len(tokens) != 1 {
+		return v
+	}
+	return tokens[0].Text
+}
+
+// analyzer 返回分词字段的 Analyzer，不分词的字段返回 nil
+func (s *Searcher) analyzer(field string) *Analyzer {
+	if a, ok := s.analyzers[field]; ok {
+		return a
+	}
+	if s.analyzed[field] {
+		return DefaultAnalyzer
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func tokenTexts(tokens []*Token) string {
+	res := []string{}
+	for i, t := range tokens {
+		if t.Position != i {
+			return "bad position"
+		}
+		res = append(res, t.Text)
+	}
+	return strings.Join(res, "|")
+}
+
+func TestBigramTokenizer(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+	}{
+		{"北京大学", "北京|京大|大学"},
+		{"中国历史，地理", "中国|国历|历史|地理"},
+		{"京", "京"},
+		{"Python 程序设计 第3版", "Python|程序|序设|设计|第|3|版"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := tokenTexts((&BigramTokenizer{}).Tokenize(c.s)); got != c.want {
+			t.Errorf("%s: %s, want %s", c.s, got, c.want)
+		}
+	}
+}
+
+func TestDictTokenizer(t *testing.T) {
+	d, err := ReadDict(strings.NewReader("# 词典\n北京\n北京大学\n大学\n\n历史\n"))
+	check(t, err)
+	cases := []struct {
+		s    string
+		want string
+	}{
+		{"北京大学历史系", "北京大学|历史|系"},
+		{"北京的大学", "北京|的|大学"},
+		{"MARC 北京", "MARC|北京"},
+	}
+	for _, c := range cases {
+		if got := tokenTexts(d.Tokenize(c.s)); got != c.want {
+			t.Errorf("%s: %s, want %s", c.s, got, c.want)
+		}
+	}
+}
+
+func TestDefaultAnalyzer(t *testing.T) {
+	if got := tokenTexts(DefaultAnalyzer.Analyze("Go语言 HTTP")); got != "go|语言|http" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestTextField(t *testing.T) {
+	s := NewSearcher()
+	add := func(name string, desc string) {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&TextField{BaseField{true, "name"}, name},
+			&TextField{BaseField{true, "desc"}, desc},
+		}})
+	}
+	add("北京大学校史", "介绍北京大学的历史")
+	add("上海地方志", "Shanghai local history")
+	add("北京历史地图集", "")
+	cases := []struct {
+		q    string
+		want []int
+	}{
+		{"name:北京", []int{0, 2}},
+		{"name:北京大学", []int{0}},
+		{"name:大学 OR desc:大学", []int{0}},
+		{"desc:HISTORY", []int{1}},
+		{"desc:历史", []int{0}},
+		{"name:历史 AND NOT desc:历史", []int{2}},
+		{"name:南京", []int{}},
+		{"name:，", []int{}},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q, "name")
+		check(t, err)
+		if got := sortedIds(s.Find(q)); !equalIds(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.q, got, c.want)
+		}
+	}
+}
+
+func TestSetAnalyzer(t *testing.T) {
+	s := NewSearcher()
+	s.SetAnalyzer("name", NewAnalyzer(NewDictTokenizer([]string{"北京大学"}), &LowercaseFilter{}))
+	s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, 0},
+		&TextField{BaseField{true, "name"}, "北京大学校史"},
+	}})
+	if got := ids(s.Find(&TermQuery{&Term{"name", "北京大学"}})); !equalIds(got, []int{0}) {
+		t.Errorf("北京大学: %v", got)
+	}
+	// 按词典切分后没有 北京 这个词
+	if got := ids(s.Find(&TermQuery{&Term{"name", "北京"}})); len(got) != 0 {
+		t.Errorf("北京: %v", got)
+	}
+}
@@ -0,0 +1,437 @@
+package search
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// 容器中的元素超过 arrayMaxSize 个时改为位图保存
+const (
+	arrayMaxSize = 4096
+	bitsLen      = 1 << 16 / 64
+)
+
+// bitmap 为压缩的 docId 集合(roaring bitmap)，按 docId 的高 16 位分为多个容器，
+// Keys 递增。运算结果总是新的 bitmap，不修改参与运算的 bitmap
+type bitmap struct {
+	Keys       []uint16
+	Containers []*container
+}
+
+// container 保存低 16 位，元素较少时 Array 为有序数组，否则 Bits 为位图，N 为位图中的元素个数
+type container struct {
+	Array []uint16
+	Bits  []uint64
+	N     int
+}
+
+func bitmapOf(it docIterator) *bitmap {
+	b := &bitmap{}
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		b.add(d)
+	}
+	return b
+}
+
+func (b *bitmap) add(doc int) {
+	k := uint16(doc >> 16)
+	i := len(b.Keys)
+	if i == 0 || b.Keys[i-1] < k {
+		b.Keys = append(b.Keys, k)
+		b.Containers = append(b.Containers, &container{})
+	} else {
+		i = sort.Search(len(b.Keys), func(j int) bool {
+			return b.Keys[j] >= k
+		})
+		if b.Keys[i] != k {
+			b.Keys = append(b.Keys, 0)
+			b.Containers = append(b.Containers, nil)
+			copy(b.Keys[i+1:], b.Keys[i:])
+			copy(b.Containers[i+1:], b.Containers[i:])
+			b.Keys[i], b.Containers[i] = k, &container{}
+		}
+	}
+	b.Containers[i].add(uint16(doc))
+}
+
+func (b *bitmap) contains(doc int) bool {
+	k := uint16(doc >> 16)
+	i := sort.Search(len(b.Keys), func(j int) bool {
+		return b.Keys[j] >= k
+	})
+	return i < len(b.Keys) && b.Keys[i] == k && b.Containers[i].contains(uint16(doc))
+}
+
+func (b *bitmap) cardinality() int {
+	n := 0
+	for _, c := range b.Containers {
+		n += c.cardinality()
+	}
+	return n
+}
+
+// append 添加高 16 位为 k 的容器，空容器不添加
+func (b *bitmap) append(k uint16, c *container) {
+	if c.cardinality() == 0 {
+		return
+	}
+	b.Keys = append(b.Keys, k)
+	b.Containers = append(b.Containers, c)
+}
+
+func (b *bitmap) and(o *bitmap) *bitmap {
+	res := &bitmap{}
+	for i, j := 0, 0; i < len(b.Keys) && j < len(o.Keys); {
+		switch {
+		case b.Keys[i] < o.Keys[j]:
+			i++
+		case b.Keys[i] > o.Keys[j]:
+			j++
+		default:
+			res.append(b.Keys[i], b.Containers[i].and(o.Containers[j]))
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+func (b *bitmap) or(o *bitmap) *bitmap {
+	res := &bitmap{}
+	i, j := 0, 0
+	for i < len(b.Keys) && j < len(o.Keys) {
+		switch {
+		case b.Keys[i] < o.Keys[j]:
+			res.append(b.Keys[i], b.Containers[i].clone())
+			i++
+		case b.Keys[i] > o.Keys[j]:
+			res.append(o.Keys[j], o.Containers[j].clone())
+			j++
+		default:
+			res.append(b.Keys[i], b.Containers[i].or(o.Containers[j]))
+			i++
+			j++
+		}
+	}
+	for ; i < len(b.Keys); i++ {
+		res.append(b.Keys[i], b.Containers[i].clone())
+	}
+	for ; j < len(o.Keys); j++ {
+		res.append(o.Keys[j], o.Containers[j].clone())
+	}
+	return res
+}
+
+// andNot 返回在 b 中但不在 o 中的元素
+func (b *bitmap) andNot(o *bitmap) *bitmap {
+	res := &bitmap{}
+	j := 0
+	for i, k := range b.Keys {
+		for j < len(o.Keys) && o.Keys[j] < k {
+			j++
+		}
+		if j < len(o.Keys) && o.Keys[j] == k {
+			res.append(k, b.Containers[i].andNot(o.Containers[j]))
+		} else {
+			res.append(k, b.Containers[i].clone())
+		}
+	}
+	return res
+}
+
+func (c *container) cardinality() int {
+	if c.Bits != nil {
+		return c.N
+	}
+	return len(c.Array)
+}
+
+func (c *container) add(v uint16) {
+	if c.Bits != nil {
+		if m := uint64(1) << (v & 63); c.Bits[v>>6]&m == 0 {
+			c.Bits[v>>6] |= m
+			c.N++
+		}
+		return
+	}
+	n := len(c.Array)
+	if n == 0 || c.Array[n-1] < v {
+		c.Array = append(c.Array, v)
+	} else {
+		i := sort.Search(n, func(j int) bool {
+			return c.Array[j] >= v
+		})
+		if c.Array[i] == v {
+			return
+		}
+		c.Array = append(c.Array, 0)
+		copy(c.Array[i+1:], c.Array[i:])
+		c.Array[i] = v
+	}
+	if len(c.Array) > arrayMaxSize {
+		c.Bits, c.N, c.Array = c.bits(), len(c.Array), nil
+	}
+}
+
+func (c *container) contains(v uint16) bool {
+	if c.Bits != nil {
+		return c.Bits[v>>6]&(uint64(1)<<(v&63)) != 0
+	}
+	i := sort.Search(len(c.Array), func(j int) bool {
+		return c.Array[j] >= v
+	})
+	return i < len(c.Array) && c.Array[i] == v
+}
+
+// next 返回第一个 >= v 的元素
+func (c *container) next(v int) (int, bool) {
+	if c.Bits == nil {
+		i := sort.Search(len(c.Array), func(j int) bool {
+			return int(c.Array[j]) >= v
+		})
+		if i < len(c.Array) {
+			return int(c.Array[i]), true
+		}
+		return 0, false
+	}
+	for w := v >> 6; w < bitsLen; w++ {
+		word := c.Bits[w]
+		if w == v>>6 {
+			word &= ^uint64(0) << uint(v&63)
+		}
+		if word != 0 {
+			return w<<6 + bits.TrailingZeros64(word), true
+		}
+	}
+	return 0, false
+}
+
+// bits 返回容器的位图副本
+func (c *container) bits() []uint64 {
+	res := make([]uint64, bitsLen)
+	if c.Bits != nil {
+		copy(res, c.Bits)
+		return res
+	}
+	for _, v := range c.Array {
+		res[v>>6] |= uint64(1) << (v & 63)
+	}
+	return res
+}
+
+func (c *container) clone() *container {
+	if c.Bits != nil {
+		return &container{Bits: c.bits(), N: c.N}
+	}
+	return &container{Array: append([]uint16{}, c.Array...)}
+}
+
+// fromBits 由位图生成容器，元素较少时转为数组
+func fromBits(b []uint64) *container {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	if n > arrayMaxSize {
+		return &container{Bits: b, N: n}
+	}
+	a := make([]uint16, 0, n)
+	for i, w := range b {
+		for w != 0 {
+			a = append(a, uint16(i<<6+bits.TrailingZeros64(w)))
+			w &= w - 1
+		}
+	}
+	return &container{Array: a}
+}
+
+// filter 返回数组中被 o 包含(keep 为 true)或不被包含的元素
+func (c *container) filter(o *container, keep bool) *container {
+	res := []uint16{}
+	for _, v := range c.Array {
+		if o.contains(v) == keep {
+			res = append(res, v)
+		}
+	}
+	return &container{Array: res}
+}
+
+func (c *container) and(o *container) *container {
+	switch {
+	case c.Bits != nil && o.Bits != nil:
+		b := make([]uint64, bitsLen)
+		for i := range b {
+			b[i] = c.Bits[i] & o.Bits[i]
+		}
+		return fromBits(b)
+	case c.Bits != nil:
+		return o.filter(c, true)
+	case o.Bits != nil:
+		return c.filter(o, true)
+	}
+	res := []uint16{}
+	for i, j := 0, 0; i < len(c.Array) && j < len(o.Array); {
+		switch {
+		case c.Array[i] < o.Array[j]:
+			i++
+		case c.Array[i] > o.Array[j]:
+			j++
+		default:
+			res = append(res, c.Array[i])
+			i++
+			j++
+		}
+	}
+	return &container{Array: res}
+}
+
+func (c *container) or(o *container) *container {
+	if c.Bits == nil && o.Bits == nil && len(c.Array)+len(o.Array) <= arrayMaxSize {
+		res := make([]uint16, 0, len(c.Array)+len(o.Array))
+		i, j := 0, 0
+		for i < len(c.Array) && j < len(o.Array) {
+			switch {
+			case c.Array[i] < o.Array[j]:
+				res = append(res, c.Array[i])
+				i++
+			case c.Array[i] > o.Array[j]:
+				res = append(res, o.Array[j])
+				j++
+			default:
+				res = append(res, c.Array[i])
+				i++
+				j++
+			}
+		}
+		res = append(res, c.Array[i:]...)
+		res = append(res, o.Array[j:]...)
+		return &container{Array: res}
+	}
+	b := c.bits()
+	if o.Bits != nil {
+		for i, w := range o.Bits {
+			b[i] |= w
+		}
+	} else {
+		for _, v := range o.Array {
+			b[v>>6] |= uint64(1) << (v & 63)
+		}
+	}
+	return fromBits(b)
+}
+
+func (c *container) andNot(o *container) *container {
+	if c.Bits == nil {
+		return c.filter(o, false)
+	}
+	b := c.bits()
+	if o.Bits != nil {
+		for i, w := range o.Bits {
+			b[i] &^= w
+		}
+	} else {
+		for _, v := range o.Array {
+			b[v>>6] &^= uint64(1) << (v & 63)
+		}
+	}
+	return fromBits(b)
+}
+
+// bitmapIterator 按递增顺序遍历 bitmap，不计算相关度
+type bitmapIterator struct {
+	b    *bitmap
+	i    int
+	doc  int
+	size int
+}
+
+func newBitmapIterator(b *bitmap) docIterator {
+	if b == nil || len(b.Keys) == 0 {
+		return &emptyIterator{-1}
+	}
+	return &bitmapIterator{b, 0, -1, b.cardinality()}
+}
+
+func (it *bitmapIterator) docID() int {
+	return it.doc
+}
+
+func (it *bitmapIterator) nextDoc() int {
+	return it.advance(it.doc + 1)
+}
+
+func (it *bitmapIterator) advance(target int) int {
+	if it.doc == noMoreDocs || it.doc >= target {
+		return it.doc
+	}
+	keys := it.b.Keys
+	k := target >> 16
+	it.i += sort.Search(len(keys)-it.i, func(j int) bool {
+		return int(keys[it.i+j]) >= k
+	})
+	for ; it.i < len(keys); it.i++ {
+		lo := 0
+		if int(keys[it.i]) == k {
+			lo = target & 0xffff
+		}
+		if v, ok := it.b.Containers[it.i].next(lo); ok {
+			it.doc = int(keys[it.i])<<16 | v
+			return it.doc
+		}
+	}
+	it.doc = noMoreDocs
+	return it.doc
+}
+
+func (it *bitmapIterator) cost() int {
+	return it.size
+}
+
+func (it *bitmapIterator) score() float64 {
+	return 0
+}
+
+// union 返回多个 bitmap 的并集，每个容器只生成一次，比依次调用 or 少复制
+func union(bs []*bitmap) *bitmap {
+	groups := map[uint16][]*container{}
+	keys := []int{}
+	for _, b := range bs {
+		for i, k := range b.Keys {
+			if _, ok := groups[k]; !ok {
+				keys = append(keys, int(k))
+			}
+			groups[k] = append(groups[k], b.Containers[i])
+		}
+	}
+	sort.Ints(keys)
+	res := &bitmap{}
+	for _, k := range keys {
+		cs := groups[uint16(k)]
+		n := 0
+		for _, c := range cs {
+			n += c.cardinality()
+		}
+		c := &container{}
+		if n <= arrayMaxSize {
+			for _, x := range cs {
+				c = c.or(x)
+			}
+		} else {
+			b := make([]uint64, bitsLen)
+			for _, x := range cs {
+				if x.Bits != nil {
+					for i, w := range x.Bits {
+						b[i] |= w
+					}
+					continue
+				}
+				for _, v := range x.Array {
+					b[v>>6] |= uint64(1) << (v & 63)
+				}
+			}
+			c = fromBits(b)
+		}
+		res.append(uint16(k), c)
+	}
+	return res
+}
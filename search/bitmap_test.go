@@ -0,0 +1,139 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randomDocs 返回 n 个不重复的随机 docId，分布在多个容器中，dense 为 true 时集中在前两个容器
+func randomDocs(r *rand.Rand, n int, dense bool) map[int]bool {
+	max := 1 << 18
+	if dense {
+		max = 1 << 17
+	}
+	res := map[int]bool{}
+	for len(res) < n {
+		res[r.Intn(max)] = true
+	}
+	return res
+}
+
+func bitmapFrom(docs map[int]bool) *bitmap {
+	b := &bitmap{}
+	for d := range docs {
+		b.add(d)
+	}
+	return b
+}
+
+func bitmapDocs(b *bitmap) []int {
+	res := []int{}
+	it := newBitmapIterator(b)
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		res = append(res, d)
+	}
+	return res
+}
+
+func keysOf(m map[int]bool) []int {
+	res := []int{}
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Ints(res)
+	return res
+}
+
+func TestBitmapOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// 分别为数组与数组、数组与位图、位图与位图之间的运算
+	sizes := [][2]int{{100, 300}, {200, 20000}, {30000, 50000}}
+	for _, size := range sizes {
+		a, b := randomDocs(r, size[0], size[0] > arrayMaxSize), randomDocs(r, size[1], size[1] > arrayMaxSize)
+		ba, bb := bitmapFrom(a), bitmapFrom(b)
+		and, or, andNot := map[int]bool{}, map[int]bool{}, map[int]bool{}
+		for d := range a {
+			or[d] = true
+			if b[d] {
+				and[d] = true
+			} else {
+				andNot[d] = true
+			}
+		}
+		for d := range b {
+			or[d] = true
+		}
+		cases := []struct {
+			name string
+			got  *bitmap
+			want map[int]bool
+		}{
+			{"a", ba, a},
+			{"and", ba.and(bb), and},
+			{"or", ba.or(bb), or},
+			{"union", union([]*bitmap{ba, bb}), or},
+			{"andNot", ba.andNot(bb), andNot},
+			{"bAndNot", bb.andNot(ba).or(bitmapFrom(and)), b},
+		}
+		for _, c := range cases {
+			if got := bitmapDocs(c.got); !equalIds(got, keysOf(c.want)) {
+				t.Errorf("%v %s: %d docs, want %d", size, c.name, len(got), len(c.want))
+			}
+			if n := c.got.cardinality(); n != len(c.want) {
+				t.Errorf("%v %s: cardinality %d, want %d", size, c.name, n, len(c.want))
+			}
+		}
+		// 运算不修改原 bitmap
+		if got := bitmapDocs(ba); !equalIds(got, keysOf(a)) {
+			t.Errorf("%v: a modified", size)
+		}
+	}
+}
+
+func TestBitmapAdvance(t *testing.T) {
+	b := &bitmap{}
+	docs := []int{3, 70000, 70001}
+	// 第三个容器为位图
+	for i := 0; i <= arrayMaxSize; i++ {
+		docs = append(docs, 3<<16+i*2)
+	}
+	for _, d := range docs {
+		b.add(d)
+	}
+	if c := b.Containers[2]; c.Bits == nil || c.N != arrayMaxSize+1 {
+		t.Fatalf("container not converted to bits")
+	}
+	cases := []struct{ target, want int }{
+		{0, 3},
+		{4, 70000},
+		{70001, 70001},
+		{70002, 3 << 16},
+		{3<<16 + 1, 3<<16 + 2},
+		{3<<16 + arrayMaxSize*2, 3<<16 + arrayMaxSize*2},
+		{3<<16 + arrayMaxSize*2 + 1, noMoreDocs},
+	}
+	for _, c := range cases {
+		it := newBitmapIterator(b)
+		if got := it.advance(c.target); got != c.want {
+			t.Errorf("advance(%d) = %d, want %d", c.target, got, c.want)
+		}
+	}
+	// 与 listIterator 相同，target 不大于当前文档时不移动
+	it := newBitmapIterator(b)
+	it.advance(70001)
+	if got := it.advance(4); got != 70001 {
+		t.Errorf("advance backwards = %d, want 70001", got)
+	}
+	if got := it.nextDoc(); got != 3<<16 {
+		t.Errorf("nextDoc after advance = %d, want %d", got, 3<<16)
+	}
+	for _, d := range docs {
+		if !b.contains(d) {
+			t.Errorf("%d not found", d)
+		}
+	}
+	if b.contains(4) || b.contains(3<<16+1) {
+		t.Errorf("contains docs not added")
+	}
+}
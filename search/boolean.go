@@ -0,0 +1,101 @@
+package search
+
+type Clause struct {
+	Q     Query
+	Occur Boolean
+}
+
+// BooleanQuery 组合任意数量的子查询：
+// 所有 MUST 子句都须匹配，MUST_NOT 子句都不能匹配；
+// 没有 MUST 子句时至少匹配 max(1, MinShouldMatch) 个 SHOULD 子句，
+// 有 MUST 子句时 SHOULD 子句只在 MinShouldMatch > 0 时作为过滤条件。
+// 只有 MUST_NOT 子句的查询没有结果。Limit 为 0 时不分页。
+// 文档的相关度为其匹配的 MUST 及 SHOULD 子句相关度之和
+type BooleanQuery struct {
+	Clauses        []*Clause
+	MinShouldMatch int
+	Start          int
+	Limit          int
+}
+
+func NewBooleanQuery(clauses ...*Clause) *BooleanQuery {
+	return &BooleanQuery{Clauses: clauses}
+}
+
+func (q *BooleanQuery) Add(c Query, occur Boolean) *BooleanQuery {
+	q.Clauses = append(q.Clauses, &Clause{c, occur})
+	return q
+}
+
+func (q *BooleanQuery) Match(t *Term) bool {
+	must, should := 0, 0
+	for _, c := range q.Clauses {
+		m := c.Q.Match(t)
+		switch c.Occur {
+		case MUST:
+			if !m {
+				return false
+			}
+			must++
+		case SHOULD:
+			if m {
+				should++
+			}
+		case MUST_NOT:
+			if m {
+				return false
+			}
+		}
+	}
+	if must == 0 || q.MinShouldMatch > 0 {
+		return should >= q.MinShouldMatch && (must > 0 || should > 0)
+	}
+	return true
+}
+
+func (q *BooleanQuery) iterator(s *Searcher, seg *segment) docIterator {
+	must, should, not := []docIterator{}, []docIterator{}, []docIterator{}
+	for _, c := range q.Clauses {
+		it := iteratorOf(s, seg, c.Q)
+		switch c.Occur {
+		case MUST:
+			must = append(must, it)
+		case SHOULD:
+			should = append(should, it)
+		case MUST_NOT:
+			not = append(not, it)
+		}
+	}
+	filter := len(should) > 0 && (len(must) == 0 || q.MinShouldMatch > 0)
+	if filter {
+		if q.MinShouldMatch > len(should) {
+			return &emptyIterator{-1}
+		}
+		must = append(must, newDisjunction(should, q.MinShouldMatch))
+	}
+	var res docIterator
+	switch len(must) {
+	case 0:
+		return &emptyIterator{-1}
+	case 1:
+		res = must[0]
+	default:
+		res = newConjunction(must)
+	}
+	// 不作为过滤条件的 SHOULD 子句只影响相关度
+	if !filter && len(should) > 0 {
+		res = &optional{res, newDisjunction(should, 1)}
+	}
+	if len(not) > 0 {
+		res = &exclusion{res, newDisjunction(not, 1)}
+	}
+	return res
+}
+
+func (q *BooleanQuery) Search(s *Searcher) *Index {
+	res := drain(s.iterator(q))
+	if res.Size == 0 {
+		return nil
+	}
+	return page(res, q.Start, q.Limit)
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"testing"
+)
+
+func termQuery(v string) *TermQuery {
+	return &TermQuery{&Term{"term", v}}
+}
+
+func TestBooleanQuery(t *testing.T) {
+	s := testSearcher()
+	cases := []struct {
+		q    *BooleanQuery
+		want []int
+	}{
+		{NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("历史"), MUST}), []int{0, 4}},
+		{NewBooleanQuery(&Clause{termQuery("地理"), SHOULD}, &Clause{termQuery("上海"), SHOULD}, &Clause{termQuery("南京"), SHOULD}), []int{1, 2, 3}},
+		{NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("历史"), MUST_NOT}, &Clause{termQuery("上海"), MUST_NOT}), []int{2, 5}},
+		{NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("上海"), SHOULD}), []int{0, 1, 2, 4, 5}},
+		{&BooleanQuery{Clauses: []*Clause{
+			&Clause{termQuery("北京"), SHOULD}, &Clause{termQuery("历史"), SHOULD}, &Clause{termQuery("上海"), SHOULD},
+		}, MinShouldMatch: 2}, []int{0, 1, 3, 4}},
+		{&BooleanQuery{Clauses: []*Clause{
+			&Clause{termQuery("北京"), MUST}, &Clause{termQuery("历史"), SHOULD}, &Clause{termQuery("上海"), SHOULD},
+		}, MinShouldMatch: 1}, []int{0, 1, 4}},
+		{&BooleanQuery{Clauses: []*Clause{
+			&Clause{termQuery("北京"), SHOULD}, &Clause{termQuery("历史"), SHOULD},
+		}, MinShouldMatch: 3}, []int{}},
+		{NewBooleanQuery(&Clause{termQuery("北京"), MUST_NOT}), []int{}},
+		{NewBooleanQuery(&Clause{termQuery("南京"), MUST}, &Clause{termQuery("北京"), SHOULD}), []int{}},
+		{NewBooleanQuery(
+			&Clause{NewBooleanQuery(&Clause{termQuery("地理"), SHOULD}, &Clause{termQuery("历史"), SHOULD}), MUST},
+			&Clause{&RangeQuery{Field: "year", Min: 1950, Max: 1960}, MUST},
+			&Clause{termQuery("上海"), MUST_NOT},
+		), []int{2, 4}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	q := NewBooleanQuery(&Clause{termQuery("北京"), MUST})
+	q.Start, q.Limit = 1, 2
+	// 文档 5 只有一个词项，相关度最高
+	if r := s.Find(q); r.Total != 5 || !equalIds(ids(r), []int{0, 1}) {
+		t.Errorf("page: total %d, %v", r.Total, ids(r))
+	}
+}
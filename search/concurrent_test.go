@@ -0,0 +1,47 @@
+package search
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// 使用 go test -race 运行以检查数据竞争
+func TestConcurrentAddFind(t *testing.T) {
+	s := NewSearcher()
+	n := 500
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			s.Add(&Document{[]Field{
+				&IntField{BaseField{true, "year"}, 1950 + i%10},
+				&StrSliceField{BaseField{true, "term"}, []string{"北京", "t" + strconv.Itoa(i%7)}},
+			}})
+		}
+	}()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			last := 0
+			for i := 0; i < n; i++ {
+				r := s.Find(&TermQuery{&Term{"term", "北京"}})
+				if r.Total < last || r.Total != len(r.Docs) {
+					t.Errorf("total %d after %d, docs %d", r.Total, last, len(r.Docs))
+					return
+				}
+				last = r.Total
+				s.Find(&BooleanQuery{Clauses: []*Clause{
+					&Clause{&TermQuery{&Term{"term", "t" + strconv.Itoa(g)}}, MUST},
+					&Clause{&TermQuery{&Term{"year", "1951"}}, MUST},
+				}, Limit: 10})
+			}
+		}(g)
+	}
+	wg.Wait()
+	if r := s.Find(&TermQuery{&Term{"term", "北京"}}); r.Total != n {
+		t.Errorf("total %d, want %d", r.Total, n)
+	}
+}
@@ -0,0 +1,126 @@
+package search
+
+// 已删除的文档超过文档总数的 compactRatio 时自动压缩索引
+const compactRatio = 0.2
+
+// Delete 删除包含词项 t 的所有文档，没有这样的文档时返回 false。t 一般为文档的唯一标识，
+// 如 id 字段，docId 在更新文档后会改变，不能作为标识。
+// 倒排表中的文档只标记为已删除，查询时排除，压缩索引时才真正删除
+func (s *Searcher) Delete(t *Term) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deleteTerm(t) == 0 {
+		return false
+	}
+	s.maybeCompact()
+	return true
+}
+
+// Update 删除包含词项 t 的文档并添加 doc，返回 doc 的 docId；没有包含 t 的文档时只添加 doc
+func (s *Searcher) Update(t *Term, doc *Document) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteTerm(t)
+	res := s.add(doc)
+	s.maybeCompact()
+	return res
+}
+
+// deleteTerm 删除包含词项 t 的未删除文档，返回删除的文档数
+func (s *Searcher) deleteTerm(t *Term) int {
+	ids := []int{}
+	it := s.iterator(&TermQuery{t})
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		ids = append(ids, d)
+	}
+	for _, id := range ids {
+		s.delete(id)
+	}
+	return len(ids)
+}
+
+func (s *Searcher) delete(id int) bool {
+	if _, ok := s.docs[id]; !ok {
+		return false
+	}
+	delete(s.docs, id)
+	s.deleted.add(id)
+	// 字段统计只计入未删除的文档
+	for field, norms := range s.norms {
+		if id >= len(norms) || norms[id] == 0 {
+			continue
+		}
+		if st, ok := s.stats[field]; ok {
+			st.Docs--
+			st.Length -= norms[id]
+		}
+		norms[id] = 0
+	}
+	return true
+}
+
+// live 排除已删除的文档
+func (s *Searcher) live(it docIterator) docIterator {
+	if len(s.deleted.Keys) == 0 {
+		return it
+	}
+	return &exclusion{it, newBitmapIterator(s.deleted)}
+}
+
+// maybeCompact 在已封存段中的已删除文档超过 compactRatio 时由后台合并清除，不在写锁内压缩；
+// 正在写入的段中的已删除文档在封存后合并时清除
+func (s *Searcher) maybeCompact() {
+	n := s.deleted.cardinality()
+	if s.cur != nil {
+		it := newBitmapIterator(s.deleted)
+		for d := it.advance(s.cur.base); d != noMoreDocs; d = it.nextDoc() {
+			n--
+		}
+	}
+	if float64(n) > float64(len(s.docs)+s.deleted.cardinality())*compactRatio {
+		s.compacting = true
+		s.maybeMerge()
+	}
+}
+
+// compactCandidate 返回第一个包含已删除文档的已封存段
+func (s *Searcher) compactCandidate() *segment {
+	for _, seg := range s.segments {
+		if it := newBitmapIterator(s.deleted); it.advance(seg.base) < seg.max {
+			return seg
+		}
+	}
+	return nil
+}
+
+// Compact 从倒排表中删除已删除的文档，并删除不再出现在任何文档中的词项，完成后才返回
+func (s *Searcher) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compact()
+}
+
+// compact 将包含已删除文档的段替换为清除后的新段，正在进行的合并会放弃其结果
+func (s *Searcher) compact() {
+	if len(s.deleted.Keys) == 0 {
+		return
+	}
+	segs := []*segment{}
+	for _, seg := range s.segments {
+		if it := newBitmapIterator(s.deleted); it.advance(seg.base) < seg.max {
+			segs = append(segs, seg)
+		}
+	}
+	for _, seg := range segs {
+		merged, purged := mergeSegments([]*segment{seg}, s.deleted, s.filterFields)
+		s.replaceSegments([]*segment{seg}, merged, purged)
+	}
+	if s.cur != nil && len(s.deleted.Keys) > 0 {
+		merged, purged := mergeSegments([]*segment{s.cur}, s.deleted, s.filterFields)
+		s.cur = merged
+		if merged.count == 0 {
+			s.cur = nil
+		}
+		s.deleted = s.deleted.andNot(purged)
+	}
+}
@@ -0,0 +1,173 @@
+package search
+
+import (
+	"strconv"
+	"testing"
+)
+
+// idTerm 返回 id 字段为 id 的词项，用于删除和更新文档
+func idTerm(id int) *Term {
+	return &Term{"id", strconv.Itoa(id)}
+}
+
+func TestDelete(t *testing.T) {
+	s := testSearcher()
+	s.SetFilterField("year")
+	if !s.Delete(idTerm(0)) || s.Delete(idTerm(0)) || s.Delete(idTerm(100)) {
+		t.Fatalf("delete result")
+	}
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{termQuery("北京"), []int{1, 2, 4, 5}},
+		{termQuery("历史"), []int{3, 4}},
+		{&RangeQuery{Field: "year", Max: 1955, NoMin: true}, []int{1, 2}},
+		{&PrefixQuery{"term", "北"}, []int{1, 2, 4, 5}},
+		{NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("上海"), MUST_NOT}), []int{2, 4, 5}},
+		{&FilteredQuery{nil, &RangeFilter{&RangeQuery{Field: "year", Max: 1950, NoMin: true}}}, []int{1}},
+	}
+	for i, c := range cases {
+		r := s.Find(c.q)
+		if got := sortedIds(r); !equalIds(got, c.want) || r.Total != len(c.want) {
+			t.Errorf("case %d: %v total %d, want %v", i, got, r.Total, c.want)
+		}
+	}
+	if idx := termQuery("北京").Search(s); idx.Size != 4 {
+		t.Errorf("Search size %d, want 4", idx.Size)
+	}
+	if st := s.stats["term"]; st.Docs != 5 {
+		t.Errorf("stats docs %d, want 5", st.Docs)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := testSearcher()
+	doc := func(year int, terms ...string) *Document {
+		return &Document{[]Field{
+			&IntField{BaseField{true, "id"}, 3},
+			&IntField{BaseField{true, "year"}, year},
+			&StrSliceField{BaseField{true, "term"}, terms},
+		}}
+	}
+	if id := s.Update(idTerm(3), doc(1961, "上海", "地理")); id != 6 {
+		t.Fatalf("new docId %d, want 6", id)
+	}
+	if got := sortedIds(s.Find(termQuery("历史"))); !equalIds(got, []int{0, 4}) {
+		t.Errorf("历史: %v", got)
+	}
+	if got := sortedIds(s.Find(termQuery("地理"))); !equalIds(got, []int{2, 3}) {
+		t.Errorf("地理: %v", got)
+	}
+	// 同一文档可以用相同的标识再次更新
+	if id := s.Update(idTerm(3), doc(1962, "天津")); id != 7 {
+		t.Fatalf("second update docId %d, want 7", id)
+	}
+	if got := sortedIds(s.Find(termQuery("地理"))); !equalIds(got, []int{2}) {
+		t.Errorf("地理 after second update: %v", got)
+	}
+	if got := sortedIds(s.Find(termQuery("天津"))); !equalIds(got, []int{3}) {
+		t.Errorf("天津: %v", got)
+	}
+	if r := s.Find(&RangeQuery{Field: "id", NoMin: true, NoMax: true}); r.Total != 6 {
+		t.Errorf("total %d, want 6", r.Total)
+	}
+	// 标识不存在时添加文档
+	s.Update(idTerm(10), &Document{[]Field{
+		&IntField{BaseField{true, "id"}, 10},
+		&StrSliceField{BaseField{true, "term"}, []string{"天津"}},
+	}})
+	if got := sortedIds(s.Find(termQuery("天津"))); !equalIds(got, []int{3, 10}) {
+		t.Errorf("天津 after insert: %v", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := testSearcher()
+	s.SetFilterField("year")
+	// 增加文档，避免删除后自动压缩
+	for i := 0; i < 10; i++ {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&IntField{BaseField{true, "year"}, 1980},
+		}})
+	}
+	s.Delete(idTerm(3))
+	s.Delete(idTerm(5))
+	l := saveLoad(t, s)
+	for _, s := range []*Searcher{s, l} {
+		if s.deleted.cardinality() != 2 {
+			t.Fatalf("deleted %d, want 2", s.deleted.cardinality())
+		}
+		s.Compact()
+		if s.deleted.cardinality() != 0 {
+			t.Errorf("deleted not cleared")
+		}
+		// 1970 只出现在文档 5 中
+		if n := termSize(s, Term{"year", "1970"}); n != -1 {
+			t.Errorf("term 1970 not removed: %d", n)
+		}
+		if n := termSize(s, Term{"term", "北京"}); n != 4 {
+			t.Errorf("北京 postings %d, want 4", n)
+		}
+		if got := sortedIds(s.Find(&RangeQuery{Field: "year", Min: 1960, Max: 1970})); !equalIds(got, []int{4}) {
+			t.Errorf("range after compact: %v", got)
+		}
+		if got := sortedIds(s.Find(&FilteredQuery{nil, yearFilter("1960")})); !equalIds(got, []int{4}) {
+			t.Errorf("filter after compact: %v", got)
+		}
+		if got := sortedIds(s.Find(&SpanNearQuery{"term", []string{"北京", "历史"}, 0, true})); !equalIds(got, []int{0, 4}) {
+			t.Errorf("positions after compact: %v", got)
+		}
+	}
+}
+
+// termSize 返回各段中词项的倒排表长度之和，词项不存在时返回 -1
+func termSize(s *Searcher, t Term) int {
+	n := -1
+	for _, seg := range s.searchSegments() {
+		if tid, ok := seg.lexicon[t]; ok {
+			if n < 0 {
+				n = 0
+			}
+			n += seg.indexes[tid].Size
+		}
+	}
+	return n
+}
+
+func TestAutoCompact(t *testing.T) {
+	s := testSearcher()
+	s.Flush()
+	// 6 个文档中删除 1 个不超过 20%，删除 2 个时在后台压缩
+	s.Delete(idTerm(0))
+	s.WaitMerges()
+	if s.deleted.cardinality() != 1 {
+		t.Fatalf("compacted too early")
+	}
+	s.Delete(idTerm(1))
+	s.WaitMerges()
+	if s.deleted.cardinality() != 0 {
+		t.Errorf("not compacted")
+	}
+	if got := sortedIds(s.Find(termQuery("北京"))); !equalIds(got, []int{2, 4, 5}) {
+		t.Errorf("after compact: %v", got)
+	}
+
+	// 正在写入的段中的已删除文档在封存后清除
+	s = testSearcher()
+	s.Delete(idTerm(0))
+	s.Delete(idTerm(1))
+	s.WaitMerges()
+	if s.deleted.cardinality() != 2 {
+		t.Fatalf("current segment compacted before flush")
+	}
+	s.Flush()
+	s.WaitMerges()
+	if s.deleted.cardinality() != 0 {
+		t.Errorf("not compacted after flush")
+	}
+	if got := sortedIds(s.Find(termQuery("北京"))); !equalIds(got, []int{2, 4, 5}) {
+		t.Errorf("after flush: %v", got)
+	}
+}
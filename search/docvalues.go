@@ -0,0 +1,164 @@
+package search
+
+import (
+	"sort"
+)
+
+// docValues 为一个字段在段内各文档的值，下标为 docId-base，按列存储以便排序时直接取值。
+// 字段第一个值为 int 时值存于 Ints，否则存于 Strings，之后类型不同的值忽略；
+// Exists 标记文档是否有值
+type docValues struct {
+	Int     bool
+	Ints    []int
+	Strings []string
+	Exists  []bool
+}
+
+// sortValue 返回字段用于排序的值，StrSliceField 取第一个值
+func sortValue(f Field) interface{} {
+	switch v := f.GetValue().(type) {
+	case int, string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return nil
+}
+
+func (dv *docValues) set(i int, v interface{}) {
+	for len(dv.Exists) <= i {
+		dv.Exists = append(dv.Exists, false)
+	}
+	switch v := v.(type) {
+	case int:
+		if !dv.Int {
+			return
+		}
+		for len(dv.Ints) <= i {
+			dv.Ints = append(dv.Ints, 0)
+		}
+		dv.Ints[i] = v
+	case string:
+		if dv.Int {
+			return
+		}
+		for len(dv.Strings) <= i {
+			dv.Strings = append(dv.Strings, "")
+		}
+		dv.Strings[i] = v
+	default:
+		return
+	}
+	dv.Exists[i] = true
+}
+
+func (dv *docValues) value(i int) interface{} {
+	if i >= len(dv.Exists) || !dv.Exists[i] {
+		return nil
+	}
+	if dv.Int {
+		return dv.Ints[i]
+	}
+	return dv.Strings[i]
+}
+
+// addDocValues 记录文档中排序字段的值，同名字段只取第一个
+func (seg *segment) addDocValues(doc int, d *Document, sortFields map[string]bool) {
+	seen := map[string]bool{}
+	for _, f := range d.Fields {
+		name := f.GetName()
+		if !sortFields[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		seg.setDocValue(name, doc, sortValue(f))
+	}
+}
+
+// fieldValue 返回文档中第一个名为 field 的字段用于排序的值
+func fieldValue(d *Document, field string) interface{} {
+	for _, f := range d.Fields {
+		if f.GetName() == field {
+			return sortValue(f)
+		}
+	}
+	return nil
+}
+
+// SetSortField 指定字段为排序字段，各段中按列保存字段的值。
+// 只有排序字段记录 doc values，按其他字段排序时从文档中取值
+func (s *Searcher) SetSortField(field string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sortFields[field] {
+		return
+	}
+	s.sortFields[field] = true
+	for i, seg := range s.segments {
+		// 已封存的段可能正在后台合并，复制后修改
+		ns := *seg
+		ns.docValues = map[string]*docValues{}
+		for f, dv := range seg.docValues {
+			ns.docValues[f] = dv
+		}
+		s.addFieldValues(&ns, field)
+		s.segments[i] = &ns
+	}
+	if s.cur != nil {
+		s.addFieldValues(s.cur, field)
+	}
+}
+
+func (s *Searcher) addFieldValues(seg *segment, field string) {
+	for d := seg.base; d < seg.max; d++ {
+		if doc, ok := s.docs[d]; ok {
+			seg.setDocValue(field, d, fieldValue(doc, field))
+		}
+	}
+}
+
+func (seg *segment) setDocValue(field string, doc int, v interface{}) {
+	if v == nil {
+		return
+	}
+	dv, ok := seg.docValues[field]
+	if !ok {
+		_, isInt := v.(int)
+		dv = &docValues{Int: isInt}
+		seg.docValues[field] = dv
+	}
+	dv.set(doc-seg.base, v)
+}
+
+// segmentOf 返回包含文档的段
+func (s *Searcher) segmentOf(doc int) *segment {
+	segs := s.searchSegments()
+	i := sort.Search(len(segs), func(j int) bool {
+		return segs[j].max > doc
+	})
+	if i < len(segs) && segs[i].base <= doc {
+		return segs[i]
+	}
+	return nil
+}
+
+// docValue 返回文档中字段 field 用于排序的值，没有值时返回 nil
+func (s *Searcher) docValue(doc int, field string) interface{} {
+	if !s.sortFields[field] {
+		if d, ok := s.docs[doc]; ok {
+			return fieldValue(d, field)
+		}
+		return nil
+	}
+	seg := s.segmentOf(doc)
+	if seg == nil {
+		return nil
+	}
+	dv, ok := seg.docValues[field]
+	if !ok {
+		return nil
+	}
+	return dv.value(doc - seg.base)
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+)
+
+// FacetRequest 统计字段 Field 的各个取值出现在多少个结果文档中，
+// 返回文档数最多的 Limit 个取值，Limit 为 0 时返回全部
+type FacetRequest struct {
+	Field string
+	Limit int
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func (s *Searcher) facets(hits []*hit, reqs []*FacetRequest) map[string][]*FacetCount {
+	counts := map[string]map[string]int{}
+	for _, r := range reqs {
+		counts[r.Field] = map[string]int{}
+	}
+	for _, h := range hits {
+		d, ok := s.docs[h.doc]
+		if !ok {
+			continue
+		}
+		for _, f := range d.Fields {
+			c, ok := counts[f.GetName()]
+			if !ok {
+				continue
+			}
+			// 同一文档中重复的值只计一次
+			seen := map[string]bool{}
+			for _, v := range facetValues(f) {
+				if !seen[v] {
+					seen[v] = true
+					c[v]++
+				}
+			}
+		}
+	}
+	res := map[string][]*FacetCount{}
+	for _, r := range reqs {
+		fc := []*FacetCount{}
+		for v, n := range counts[r.Field] {
+			fc = append(fc, &FacetCount{v, n})
+		}
+		sort.Slice(fc, func(i, j int) bool {
+			if fc[i].Count != fc[j].Count {
+				return fc[i].Count > fc[j].Count
+			}
+			return fc[i].Value < fc[j].Value
+		})
+		if r.Limit > 0 && len(fc) > r.Limit {
+			fc = fc[:r.Limit]
+		}
+		res[r.Field] = fc
+	}
+	return res
+}
+
+// facetValues 返回字段的原始值，不分词
+func facetValues(f Field) []string {
+	switch v := f.GetValue().(type) {
+	case int:
+		return []string{strconv.Itoa(v)}
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"strconv"
+	"testing"
+)
+
+func facetString(fc []*FacetCount) string {
+	res := ""
+	for _, c := range fc {
+		res += c.Value + ":" + strconv.Itoa(c.Count) + " "
+	}
+	return res
+}
+
+func TestFindFacets(t *testing.T) {
+	s := testSearcher()
+	q := &PageQuery{termQuery("北京"), 0, 2}
+	r := s.FindFacets(q, []*FacetRequest{{"year", 0}, {"term", 2}})
+	if r.Total != 5 || len(r.Docs) != 2 {
+		t.Fatalf("total %d, docs %d", r.Total, len(r.Docs))
+	}
+	// 统计全部 5 个结果，不只是当前页
+	if got := facetString(r.Facets["year"]); got != "1949:1 1950:1 1955:1 1960:1 1970:1 " {
+		t.Errorf("year: %s", got)
+	}
+	if got := facetString(r.Facets["term"]); got != "北京:5 历史:2 " {
+		t.Errorf("term: %s", got)
+	}
+	r = s.FindFacets(termQuery("历史"), []*FacetRequest{{"year", 0}, {"none", 0}})
+	if got := facetString(r.Facets["year"]); got != "1960:2 1949:1 " {
+		t.Errorf("year: %s", got)
+	}
+	if len(r.Facets["none"]) != 0 {
+		t.Errorf("none: %v", r.Facets["none"])
+	}
+	if r := s.FindSorted(termQuery("历史")); r.Facets != nil {
+		t.Errorf("unexpected facets")
+	}
+	r = s.FindFacets(termQuery("南京"), []*FacetRequest{{"term", 0}})
+	if r.Total != 0 || len(r.Facets["term"]) != 0 {
+		t.Errorf("empty: %d %v", r.Total, r.Facets)
+	}
+}
+
+func TestFacetDuplicateValues(t *testing.T) {
+	s := NewSearcher()
+	s.Add(&Document{[]Field{&StrSliceField{BaseField{true, "term"}, []string{"北京", "北京"}}}})
+	r := s.FindFacets(termQuery("北京"), []*FacetRequest{{"term", 0}})
+	if got := facetString(r.Facets["term"]); got != "北京:1 " {
+		t.Errorf("term: %s", got)
+	}
+}
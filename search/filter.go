@@ -0,0 +1,221 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Filter 为不计算相关度的过滤条件，在每个段中的结果以 bitmap 表示，按 key 缓存在段中
+type Filter interface {
+	key() string
+	bitmap(s *Searcher, seg *segment) *bitmap
+}
+
+// TermFilter 过滤包含词项的文档，与 TermQuery 匹配的文档相同
+type TermFilter struct {
+	T *Term
+}
+
+func (f *TermFilter) key() string {
+	return fmt.Sprintf("term(%q:%q)", f.T.Field, f.T.Value)
+}
+
+func (f *TermFilter) bitmap(s *Searcher, seg *segment) *bitmap {
+	if tid, ok := seg.lexicon[*f.T]; ok {
+		if b, ok := seg.bitmaps[tid]; ok {
+			return b
+		}
+	}
+	return bitmapOf((&TermQuery{f.T}).iterator(s, seg))
+}
+
+// RangeFilter 过滤数值在范围内的文档，与 RangeQuery 匹配的文档相同
+type RangeFilter struct {
+	Range *RangeQuery
+}
+
+func (f *RangeFilter) key() string {
+	return fmt.Sprintf("range(%+v)", *f.Range)
+}
+
+func (f *RangeFilter) bitmap(s *Searcher, seg *segment) *bitmap {
+	ni, ok := seg.numericIndex(f.Range.Field)
+	if !ok {
+		return &bitmap{}
+	}
+	lo, hi := f.Range.bounds(ni)
+	if lo >= hi {
+		return &bitmap{}
+	}
+	tids := ni.Terms[lo:hi]
+	bs := []*bitmap{}
+	for _, tid := range tids {
+		b, ok := seg.bitmaps[tid]
+		if !ok {
+			return bitmapOf(seg.unionTerms(tids))
+		}
+		bs = append(bs, b)
+	}
+	return union(bs)
+}
+
+// BooleanFilter 组合多个过滤条件：须满足所有 Must，至少满足一个 Should(Should 不为空时)，
+// 不能满足任何 MustNot。Must 与 Should 都为空时没有结果
+type BooleanFilter struct {
+	Must    []Filter
+	Should  []Filter
+	MustNot []Filter
+}
+
+func (f *BooleanFilter) key() string {
+	parts := []string{}
+	for _, c := range []struct {
+		prefix  string
+		filters []Filter
+	}{{"+", f.Must}, {"", f.Should}, {"-", f.MustNot}} {
+		for _, sub := range c.filters {
+			parts = append(parts, c.prefix+sub.key())
+		}
+	}
+	return "bool(" + strings.Join(parts, " ") + ")"
+}
+
+func (f *BooleanFilter) bitmap(s *Searcher, seg *segment) *bitmap {
+	var res *bitmap
+	for _, sub := range f.Must {
+		if res == nil {
+			res = s.filter(seg, sub)
+		} else {
+			res = res.and(s.filter(seg, sub))
+		}
+	}
+	if len(f.Should) > 0 {
+		bs := []*bitmap{}
+		for _, sub := range f.Should {
+			bs = append(bs, s.filter(seg, sub))
+		}
+		should := union(bs)
+		if res == nil {
+			res = should
+		} else {
+			res = res.and(should)
+		}
+	}
+	if res == nil {
+		return &bitmap{}
+	}
+	for _, sub := range f.MustNot {
+		res = res.andNot(s.filter(seg, sub))
+	}
+	return res
+}
+
+// FilteredQuery 返回 Q 匹配且满足 Filter 的文档，相关度只由 Q 计算。
+// Q 为 nil 时返回满足 Filter 的所有文档
+type FilteredQuery struct {
+	Q      Query
+	Filter Filter
+}
+
+func (q *FilteredQuery) Match(t *Term) bool {
+	return q.Q != nil && q.Q.Match(t)
+}
+
+func (q *FilteredQuery) iterator(s *Searcher, seg *segment) docIterator {
+	f := newBitmapIterator(s.filter(seg, q.Filter))
+	if q.Q == nil {
+		return f
+	}
+	return newConjunction([]docIterator{iteratorOf(s, seg, q.Q), f})
+}
+
+func (q *FilteredQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+// 缓存的过滤条件数，超过时删除最早加入的
+const filterCacheSize = 256
+
+// filterCache 缓存过滤条件的结果，查询持有 Searcher 的读锁时可能同时访问，由 mu 保护。
+// 已封存的段不再修改，缓存一直有效；正在写入的段添加文档后清空
+type filterCache struct {
+	mu   sync.Mutex
+	m    map[string]*bitmap
+	keys []string
+}
+
+func (c *filterCache) get(key string) (*bitmap, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.m[key]
+	return b, ok
+}
+
+func (c *filterCache) put(key string, b *bitmap) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = map[string]*bitmap{}
+	}
+	if _, ok := c.m[key]; ok {
+		return
+	}
+	if len(c.keys) >= filterCacheSize {
+		delete(c.m, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+	c.m[key] = b
+	c.keys = append(c.keys, key)
+}
+
+func (c *filterCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m, c.keys = nil, nil
+}
+
+// filter 返回过滤条件在段中的结果，优先使用缓存。结果包括已删除的文档
+func (s *Searcher) filter(seg *segment, f Filter) *bitmap {
+	key := f.key()
+	if b, ok := seg.filters.get(key); ok {
+		return b
+	}
+	b := f.bitmap(s, seg)
+	seg.filters.put(key, b)
+	return b
+}
+
+// SetFilterField 指定字段为过滤字段，字段的每个取值另外以 bitmap 保存，
+// 用于 TermFilter、RangeFilter。已添加的文档会立即生成 bitmap
+func (s *Searcher) SetFilterField(field string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filterFields[field] {
+		return
+	}
+	s.filterFields[field] = true
+	for i, seg := range s.segments {
+		// 已封存的段可能正在后台合并，复制后修改
+		ns := *seg
+		ns.bitmaps = map[int]*bitmap{}
+		for tid, b := range seg.bitmaps {
+			ns.bitmaps[tid] = b
+		}
+		ns.filters = &filterCache{}
+		ns.addBitmaps(field)
+		s.segments[i] = &ns
+	}
+	if s.cur != nil {
+		s.cur.addBitmaps(field)
+		s.cur.filters.clear()
+	}
+}
+
+func (seg *segment) addBitmaps(field string) {
+	if d, ok := seg.dicts[field]; ok {
+		for _, tid := range d.Terms {
+			seg.bitmaps[tid] = bitmapOf(newListIterator(seg.indexes[tid]))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"testing"
+)
+
+func yearFilter(v string) Filter {
+	return &TermFilter{&Term{"year", v}}
+}
+
+func TestFilteredQuery(t *testing.T) {
+	s := testSearcher()
+	s.SetFilterField("year")
+	years := &RangeFilter{&RangeQuery{Field: "year", Min: 1950, Max: 1960}}
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&FilteredQuery{termQuery("北京"), yearFilter("1960")}, []int{4}},
+		{&FilteredQuery{termQuery("北京"), years}, []int{1, 2, 4}},
+		{&FilteredQuery{nil, years}, []int{1, 2, 3, 4}},
+		// 非过滤字段由倒排表生成
+		{&FilteredQuery{nil, &TermFilter{&Term{"term", "历史"}}}, []int{0, 3, 4}},
+		{&FilteredQuery{termQuery("北京"), &BooleanFilter{Should: []Filter{yearFilter("1949"), yearFilter("1970")}}}, []int{0, 5}},
+		{&FilteredQuery{nil, &BooleanFilter{Must: []Filter{years}, MustNot: []Filter{yearFilter("1960")}}}, []int{1, 2}},
+		{&FilteredQuery{nil, &BooleanFilter{
+			Must:   []Filter{&TermFilter{&Term{"term", "北京"}}},
+			Should: []Filter{yearFilter("1955"), yearFilter("1960")},
+		}}, []int{2, 4}},
+		{&FilteredQuery{nil, &BooleanFilter{MustNot: []Filter{years}}}, []int{}},
+		{&FilteredQuery{nil, yearFilter("1900")}, []int{}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 过滤条件不影响相关度
+	a, b := s.Find(termQuery("北京")), s.Find(&FilteredQuery{termQuery("北京"), years})
+	if b.Scores[0] <= 0 || b.Scores[0] > a.Scores[0] {
+		t.Errorf("filtered scores %v, unfiltered %v", b.Scores, a.Scores)
+	}
+}
+
+func TestFilterCache(t *testing.T) {
+	s := testSearcher()
+	s.SetFilterField("year")
+	f := &BooleanFilter{Should: []Filter{yearFilter("1949"), yearFilter("1960")}}
+	s.Find(&FilteredQuery{nil, f})
+	cached, ok := s.cur.filters.get(f.key())
+	if !ok {
+		t.Fatalf("filter not cached")
+	}
+	if _, ok := s.cur.filters.get(yearFilter("1949").key()); !ok {
+		t.Errorf("sub filter not cached")
+	}
+	if b := s.filter(s.cur, &BooleanFilter{Should: []Filter{yearFilter("1949"), yearFilter("1960")}}); b != cached {
+		t.Errorf("equal filter not reused")
+	}
+	// 添加文档后缓存失效
+	s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, s.docCurId},
+		&IntField{BaseField{true, "year"}, 1949},
+	}})
+	if _, ok := s.cur.filters.get(f.key()); ok {
+		t.Errorf("cache not cleared after Add")
+	}
+	if got := sortedIds(s.Find(&FilteredQuery{nil, f})); !equalIds(got, []int{0, 3, 4, 6}) {
+		t.Errorf("after add: %v", got)
+	}
+}
+
+func TestFilterSaveLoad(t *testing.T) {
+	s := testSearcher()
+	s.SetFilterField("year")
+	l := saveLoad(t, s)
+	if !l.filterFields["year"] || len(l.segments[0].bitmaps) != len(s.cur.bitmaps) {
+		t.Fatalf("bitmaps not loaded")
+	}
+	q := &FilteredQuery{termQuery("北京"), &RangeFilter{&RangeQuery{Field: "year", Min: 1955, NoMax: true}}}
+	if got := sortedIds(l.Find(q)); !equalIds(got, []int{2, 4, 5}) {
+		t.Errorf("after load: %v", got)
+	}
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// FuzzyQuery 查询与 Value 的编辑距离不超过 MaxEdits 的词，
+// MaxEdits 为 0 时按长度确定：1 至 2 个字不允许差别，3 至 5 个字为 1，更长为 2；最大为 fuzzyMaxEdits。
+// PrefixLength 为开头须完全相同的字数。与原词差别越大得分越低
+type FuzzyQuery struct {
+	Field        string
+	Value        string
+	MaxEdits     int
+	PrefixLength int
+}
+
+// 模糊查询最多展开的词数，超过时保留编辑距离最小的词
+const fuzzyMaxExpansions = 50
+
+// 编辑距离更大时匹配的词过多，且自动机状态数随距离迅速增长
+const fuzzyMaxEdits = 2
+
+func (q *FuzzyQuery) maxEdits(n int) int {
+	if q.MaxEdits > fuzzyMaxEdits {
+		return fuzzyMaxEdits
+	}
+	if q.MaxEdits > 0 {
+		return q.MaxEdits
+	}
+	switch {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return 2
+}
+
+// Match 没有 Searcher 时按 DefaultAnalyzer 统一 Value 的写法，与 iterator 一样比较规范化后的词
+func (q *FuzzyQuery) Match(t *Term) bool {
+	if t.Field != q.Field {
+		return false
+	}
+	v := []rune(DefaultAnalyzer.normalize(q.Value))
+	a := newLevenshtein(v, q.maxEdits(len(v)))
+	row := a.start()
+	for _, c := range t.Value {
+		row = a.step(row, c)
+	}
+	return a.isMatch(row)
+}
+
+type fuzzyTerm struct {
+	tid   int
+	dist  int
+	value string
+}
+
+func (q *FuzzyQuery) iterator(s *Searcher, seg *segment) docIterator {
+	v := []rune(s.normalize(q.Field, q.Value))
+	prefix := ""
+	if q.PrefixLength > 0 && q.PrefixLength <= len(v) {
+		prefix = string(v[:q.PrefixLength])
+	}
+	matches := seg.fuzzyTerms(q.Field, prefix, newLevenshtein(v, q.maxEdits(len(v))))
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].dist < matches[j].dist
+	})
+	if len(matches) > fuzzyMaxExpansions {
+		matches = matches[:fuzzyMaxExpansions]
+	}
+	its := []docIterator{}
+	for _, m := range matches {
+		it := s.termIterator(seg, &Term{q.Field, m.value})
+		if l, ok := it.(*listIterator); ok && l.scorer != nil {
+			n := len(v)
+			if k := len([]rune(m.value)); k < n {
+				n = k
+			}
+			l.scorer.boost = 1 - float64(m.dist)/float64(n)
+			if l.scorer.boost < 0.1 {
+				l.scorer.boost = 0.1
+			}
+		}
+		its = append(its, it)
+	}
+	if len(its) == 0 {
+		return &emptyIterator{-1}
+	}
+	return newDisjunction(its, 1)
+}
+
+func (q *FuzzyQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+// fuzzyTerms 按字典序遍历以 prefix 开头的词，与前一个词相同的前缀复用自动机状态，
+// 某个前缀已不可能匹配时跳过以该前缀开头的所有词
+func (seg *segment) fuzzyTerms(field string, prefix string, a *levenshtein) []*fuzzyTerm {
+	d, ok := seg.dict(field)
+	if !ok {
+		return nil
+	}
+	res := []*fuzzyTerm{}
+	// rows[k] 为读入词的前 k 个字后的状态
+	rows := [][]int{a.start()}
+	var last []rune
+	for i := sort.SearchStrings(d.Values, prefix); i < len(d.Values); {
+		value := d.Values[i]
+		if !strings.HasPrefix(value, prefix) {
+			break
+		}
+		r := []rune(value)
+		k := commonPrefix(last, r)
+		if k > len(rows)-1 {
+			k = len(rows) - 1
+		}
+		rows = rows[:k+1]
+		dead := -1
+		for ; k < len(r); k++ {
+			row := a.step(rows[k], r[k])
+			rows = append(rows, row)
+			if !a.canMatch(row) {
+				dead = k + 1
+				break
+			}
+		}
+		last = r
+		if dead < 0 {
+			if row := rows[len(r)]; a.isMatch(row) {
+				res = append(res, &fuzzyTerm{d.Terms[i], row[len(row)-1], value})
+			}
+			i++
+			continue
+		}
+		// 跳过以 r[:dead] 开头的词
+		p := string(r[:dead])
+		i += sort.Search(len(d.Values)-i, func(j int) bool {
+			return !strings.HasPrefix(d.Values[i+j], p)
+		})
+	}
+	return res
+}
+
+func commonPrefix(a []rune, b []rune) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// levenshtein 为编辑距离自动机，状态为原词各前缀与已读入文本的编辑距离，
+// 超过 max 的距离记为 max+1
+type levenshtein struct {
+	s   []rune
+	max int
+}
+
+func newLevenshtein(s []rune, max int) *levenshtein {
+	return &levenshtein{s, max}
+}
+
+func (l *levenshtein) start() []int {
+	row := make([]int, len(l.s)+1)
+	for i := range row {
+		row[i] = l.limit(i)
+	}
+	return row
+}
+
+func (l *levenshtein) limit(d int) int {
+	if d > l.max {
+		return l.max + 1
+	}
+	return d
+}
+
+func (l *levenshtein) step(row []int, c rune) []int {
+	next := make([]int, len(row))
+	next[0] = l.limit(row[0] + 1)
+	for i := 1; i < len(row); i++ {
+		cost := 1
+		if l.s[i-1] == c {
+			cost = 0
+		}
+		d := row[i-1] + cost
+		if row[i]+1 < d {
+			d = row[i] + 1
+		}
+		if next[i-1]+1 < d {
+			d = next[i-1] + 1
+		}
+		next[i] = l.limit(d)
+	}
+	return next
+}
+
+func (l *levenshtein) isMatch(row []int) bool {
+	return row[len(row)-1] <= l.max
+}
+
+// canMatch 为 false 时再读入任何文本都不能匹配
+func (l *levenshtein) canMatch(row []int) bool {
+	for _, d := range row {
+		if d <= l.max {
+			return true
+		}
+	}
+	return false
+}
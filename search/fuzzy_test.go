@@ -0,0 +1,154 @@
+package search
+
+import (
+	"testing"
+)
+
+func fuzzySearcher() *Searcher {
+	s := NewSearcher()
+	s.SetAnalyzer("term", KeywordAnalyzer)
+	for _, terms := range [][]string{
+		{"中国近代史"},
+		{"中國近代史"},
+		{"中国古代史"},
+		{"中国现代史", "经济"},
+		{"近代史"},
+		{"经济学"},
+		{"economy"},
+	} {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&StrSliceField{BaseField{true, "term"}, terms},
+			&TextField{BaseField{true, "name"}, terms[0]},
+		}})
+	}
+	return s
+}
+
+func TestSimplified(t *testing.T) {
+	s := fuzzySearcher()
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&TermQuery{&Term{"term", "中国近代史"}}, []int{0, 1}},
+		{&TermQuery{&Term{"term", "中國近代史"}}, []int{0, 1}},
+		{&TermQuery{&Term{"name", "國近"}}, []int{0, 1}},
+		{&PrefixQuery{"term", "中國"}, []int{0, 1, 2, 3}},
+		{&PhraseQuery{"term", []string{"中國現代史", "經濟"}}, []int{3}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	if got := toSimplified("國家圖書館 abc"); got != "国家图书馆 abc" {
+		t.Errorf("toSimplified: %s", got)
+	}
+}
+
+func TestFuzzyQuery(t *testing.T) {
+	s := fuzzySearcher()
+	cases := []struct {
+		q    *FuzzyQuery
+		want []int
+	}{
+		{&FuzzyQuery{Field: "term", Value: "中国近代史"}, []int{0, 1, 2, 3}},
+		{&FuzzyQuery{Field: "term", Value: "中国近代史", MaxEdits: 2}, []int{0, 1, 2, 3, 4}},
+		{&FuzzyQuery{Field: "term", Value: "中国近代"}, []int{0, 1}},
+		{&FuzzyQuery{Field: "term", Value: "近代史", PrefixLength: 1}, []int{4}},
+		{&FuzzyQuery{Field: "term", Value: "经济"}, []int{3}},
+		{&FuzzyQuery{Field: "term", Value: "经济", MaxEdits: 1}, []int{3, 5}},
+		{&FuzzyQuery{Field: "term", Value: "economi"}, []int{6}},
+		{&FuzzyQuery{Field: "term", Value: "日本"}, []int{}},
+		{&FuzzyQuery{Field: "none", Value: "日本"}, []int{}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 编辑距离最大为 fuzzyMaxEdits
+	if got := sortedIds(s.Find(&FuzzyQuery{Field: "term", Value: "中国近代史", MaxEdits: 5})); !equalIds(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("max edits: %v", got)
+	}
+	// Match 与查询一样统一繁简写法及大小写
+	matches := []struct {
+		q     *FuzzyQuery
+		value string
+		want  bool
+	}{
+		{&FuzzyQuery{Field: "term", Value: "中國近代史"}, "中国近代史", true},
+		{&FuzzyQuery{Field: "term", Value: "中國古代使"}, "中国近代史", false},
+		{&FuzzyQuery{Field: "term", Value: "ECONOMI"}, "economy", true},
+		// 两个字的词默认不允许差别
+		{&FuzzyQuery{Field: "term", Value: "北京"}, "南京", false},
+		{&FuzzyQuery{Field: "term", Value: "北京", MaxEdits: 1}, "南京", true},
+		{&FuzzyQuery{Field: "term", Value: "近代史", MaxEdits: 5}, "中国近代史", true},
+		{&FuzzyQuery{Field: "term", Value: "史", MaxEdits: 5}, "中国近代史", false},
+	}
+	for _, m := range matches {
+		if got := m.q.Match(&Term{"term", m.value}); got != m.want {
+			t.Errorf("%s matches %s: %v", m.q.Value, m.value, got)
+		}
+	}
+	// 完全匹配的词得分最高
+	r := s.Find(&FuzzyQuery{Field: "term", Value: "中国古代史"})
+	if got := ids(r); got[0] != 2 || r.Scores[0] <= r.Scores[1] {
+		t.Errorf("ranking: %v %v", got, r.Scores)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	dist := func(a, b string, max int) int {
+		l := newLevenshtein([]rune(a), max)
+		row := l.start()
+		for _, c := range b {
+			row = l.step(row, c)
+		}
+		return row[len(row)-1]
+	}
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"中国", "中国", 0},
+		{"中国", "中华", 1},
+		{"中国史", "国史", 1},
+		{"abc", "xyz", 3},
+	}
+	for _, c := range cases {
+		if got := dist(c.a, c.b, 3); got != c.want {
+			t.Errorf("%s %s: %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+	// 超过 max 的距离记为 max+1
+	if got := dist("kitten", "sitting", 1); got != 2 {
+		t.Errorf("limit: %d", got)
+	}
+}
+
+func TestParseFuzzy(t *testing.T) {
+	s := fuzzySearcher()
+	cases := []struct {
+		q    string
+		want []int
+	}{
+		{"中国进代史~", []int{0, 1, 2, 3}},
+		{"中国近代史~2", []int{0, 1, 2, 3, 4}},
+		{"中国近代史~0", []int{0, 1}},
+		{"经济~1 AND NOT 经济学", []int{3}},
+		{"经济~", []int{3}},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q, "term")
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		if got := sortedIds(s.Find(q)); !equalIds(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.q, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+const noMoreDocs = math.MaxInt32
+
+// docIterator 按 docId 递增顺序遍历匹配的文档，
+// 初始位置为 -1，遍历结束后 docID 返回 noMoreDocs
+type docIterator interface {
+	docID() int
+	nextDoc() int
+	// advance 移动到第一个 >= target 的文档
+	advance(target int) int
+	// cost 为匹配文档数的估计值
+	cost() int
+	// score 为当前文档的相关度
+	score() float64
+}
+
+// iterable 由能直接产生 docIterator 的查询实现，返回段 seg 中匹配的文档。
+// 其余查询由 Search 的结果转换
+type iterable interface {
+	iterator(s *Searcher, seg *segment) docIterator
+}
+
+func iteratorOf(s *Searcher, seg *segment, q Query) docIterator {
+	if it, ok := q.(iterable); ok {
+		return it.iterator(s, seg)
+	}
+	return &clipIterator{newListIterator(q.Search(s)), seg.base, seg.max, -1}
+}
+
+func drain(it docIterator) *Index {
+	res := &Index{}
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		res.add(d, 1, nil)
+	}
+	return res
+}
+
+type emptyIterator struct {
+	doc int
+}
+
+func (it *emptyIterator) docID() int {
+	return it.doc
+}
+
+func (it *emptyIterator) nextDoc() int {
+	it.doc = noMoreDocs
+	return it.doc
+}
+
+func (it *emptyIterator) advance(target int) int {
+	return it.nextDoc()
+}
+
+func (it *emptyIterator) cost() int {
+	return 0
+}
+
+func (it *emptyIterator) score() float64 {
+	return 0
+}
+
+// sliceIterator 遍历有序的 docId 数组，重复的 docId 只返回一次
+type sliceIterator struct {
+	docs []int
+	i    int
+	doc  int
+}
+
+func newSliceIterator(docs []int) docIterator {
+	return &sliceIterator{docs, -1, -1}
+}
+
+func (it *sliceIterator) docID() int {
+	return it.doc
+}
+
+func (it *sliceIterator) nextDoc() int {
+	return it.advance(it.doc + 1)
+}
+
+func (it *sliceIterator) advance(target int) int {
+	if it.i < 0 {
+		it.i = 0
+	}
+	n := len(it.docs) - it.i
+	it.i += sort.Search(n, func(j int) bool {
+		return it.docs[it.i+j] >= target
+	})
+	if it.i >= len(it.docs) {
+		it.doc = noMoreDocs
+	} else {
+		it.doc = it.docs[it.i]
+	}
+	return it.doc
+}
+
+func (it *sliceIterator) cost() int {
+	return len(it.docs)
+}
+
+func (it *sliceIterator) score() float64 {
+	return 0
+}
+
+// conjunction 为所有子迭代器的交集
+type conjunction struct {
+	its []docIterator
+	doc int
+}
+
+func newConjunction(its []docIterator) docIterator {
+	sort.Slice(its, func(i, j int) bool {
+		return its[i].cost() < its[j].cost()
+	})
+	return &conjunction{its, -1}
+}
+
+func (c *conjunction) docID() int {
+	return c.doc
+}
+
+func (c *conjunction) nextDoc() int {
+	return c.advance(c.doc + 1)
+}
+
+func (c *conjunction) advance(target int) int {
+	if c.doc == noMoreDocs {
+		return c.doc
+	}
+	d := c.its[0].advance(target)
+	for i := 1; i < len(c.its) && d != noMoreDocs; {
+		n := c.its[i].advance(d)
+		if n == d {
+			i++
+			continue
+		}
+		d = c.its[0].advance(n)
+		i = 1
+	}
+	c.doc = d
+	return d
+}
+
+func (c *conjunction) cost() int {
+	return c.its[0].cost()
+}
+
+func (c *conjunction) score() float64 {
+	sum := 0.0
+	for _, it := range c.its {
+		sum += it.score()
+	}
+	return sum
+}
+
+// disjunction 为至少 min 个子迭代器匹配的文档
+type disjunction struct {
+	its []docIterator
+	min int
+	doc int
+	// matched 为当前文档匹配的子迭代器数量
+	matched int
+}
+
+func newDisjunction(its []docIterator, min int) docIterator {
+	if min < 1 {
+		min = 1
+	}
+	return &disjunction{its: its, min: min, doc: -1}
+}
+
+func (d *disjunction) docID() int {
+	return d.doc
+}
+
+func (d *disjunction) nextDoc() int {
+	return d.advance(d.doc + 1)
+}
+
+func (d *disjunction) advance(target int) int {
+	if d.doc == noMoreDocs {
+		return d.doc
+	}
+	for {
+		min, n := noMoreDocs, 0
+		for _, it := range d.its {
+			c := it.docID()
+			if c < target {
+				c = it.advance(target)
+			}
+			if c < min {
+				min, n = c, 1
+			} else if c == min {
+				n++
+			}
+		}
+		if min == noMoreDocs || n >= d.min {
+			d.doc, d.matched = min, n
+			return min
+		}
+		target = min + 1
+	}
+}
+
+func (d *disjunction) cost() int {
+	c := 0
+	for _, it := range d.its {
+		c += it.cost()
+	}
+	return c
+}
+
+func (d *disjunction) score() float64 {
+	sum := 0.0
+	for _, it := range d.its {
+		if it.docID() == d.doc {
+			sum += it.score()
+		}
+	}
+	return sum
+}
+
+// exclusion 为 req 中不被 excl 匹配的文档
+type exclusion struct {
+	req  docIterator
+	excl docIterator
+}
+
+func (e *exclusion) docID() int {
+	return e.req.docID()
+}
+
+func (e *exclusion) nextDoc() int {
+	return e.check(e.req.nextDoc())
+}
+
+func (e *exclusion) advance(target int) int {
+	return e.check(e.req.advance(target))
+}
+
+func (e *exclusion) check(d int) int {
+	for d != noMoreDocs {
+		x := e.excl.docID()
+		if x < d {
+			x = e.excl.advance(d)
+		}
+		if x != d {
+			return d
+		}
+		d = e.req.nextDoc()
+	}
+	return d
+}
+
+func (e *exclusion) cost() int {
+	return e.req.cost()
+}
+
+func (e *exclusion) score() float64 {
+	return e.req.score()
+}
+
+// optional 遍历 req 的文档，opt 只在匹配当前文档时累加相关度
+type optional struct {
+	req docIterator
+	opt docIterator
+}
+
+func (o *optional) docID() int {
+	return o.req.docID()
+}
+
+func (o *optional) nextDoc() int {
+	return o.req.nextDoc()
+}
+
+func (o *optional) advance(target int) int {
+	return o.req.advance(target)
+}
+
+func (o *optional) cost() int {
+	return o.req.cost()
+}
+
+func (o *optional) score() float64 {
+	sum := o.req.score()
+	d := o.req.docID()
+	x := o.opt.docID()
+	if x < d {
+		x = o.opt.advance(d)
+	}
+	if x == d {
+		sum += o.opt.score()
+	}
+	return sum
+}
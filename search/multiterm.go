@@ -0,0 +1,239 @@
+package search
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// termDict 按字典序保存字段的所有词及对应的词项 id，
+// 前 sorted 个为已排序的词，之后为新添加的词，使用前由 sort 合并
+type termDict struct {
+	Values []string
+	Terms  []int
+	sorted int
+}
+
+// addTerm 只追加词，逐个插入有序数组在合并段时为平方复杂度
+func (seg *segment) addTerm(t Term, tid int) {
+	d, ok := seg.dicts[t.Field]
+	if !ok {
+		d = &termDict{}
+		seg.dicts[t.Field] = d
+	}
+	d.Values = append(d.Values, t.Value)
+	d.Terms = append(d.Terms, tid)
+}
+
+// dict 返回排序后的 termDict。查询时只持有读锁，由 dictMu 保证只有一个查询排序正在写入的段
+func (seg *segment) dict(field string) (*termDict, bool) {
+	seg.dictMu.Lock()
+	defer seg.dictMu.Unlock()
+	d, ok := seg.dicts[field]
+	if ok {
+		d.sort()
+	}
+	return d, ok
+}
+
+// sortDicts 排序所有字段新添加的词及数值，在段封存或合并后调用
+func (seg *segment) sortDicts() {
+	for _, d := range seg.dicts {
+		d.sort()
+	}
+	for _, ni := range seg.numeric {
+		ni.sort()
+	}
+}
+
+// sort 将新添加的词排序后与已排序的词合并
+func (d *termDict) sort() {
+	if d.sorted == len(d.Values) {
+		return
+	}
+	sort.Sort(&termDict{Values: d.Values[d.sorted:], Terms: d.Terms[d.sorted:]})
+	values, terms := make([]string, 0, len(d.Values)), make([]int, 0, len(d.Terms))
+	i, j := 0, d.sorted
+	for i < d.sorted || j < len(d.Values) {
+		if j == len(d.Values) || i < d.sorted && d.Values[i] < d.Values[j] {
+			values, terms = append(values, d.Values[i]), append(terms, d.Terms[i])
+			i++
+		} else {
+			values, terms = append(values, d.Values[j]), append(terms, d.Terms[j])
+			j++
+		}
+	}
+	d.Values, d.Terms, d.sorted = values, terms, len(values)
+}
+
+// buildDicts 根据词典重建 termDict，用于加载索引
+func (seg *segment) buildDicts() {
+	seg.dicts = map[string]*termDict{}
+	for t, tid := range seg.lexicon {
+		d, ok := seg.dicts[t.Field]
+		if !ok {
+			d = &termDict{}
+			seg.dicts[t.Field] = d
+		}
+		d.Values = append(d.Values, t.Value)
+		d.Terms = append(d.Terms, tid)
+	}
+	for _, d := range seg.dicts {
+		sort.Sort(d)
+		d.sorted = len(d.Values)
+	}
+}
+
+func (d *termDict) Len() int {
+	return len(d.Values)
+}
+
+func (d *termDict) Less(i, j int) bool {
+	return d.Values[i] < d.Values[j]
+}
+
+func (d *termDict) Swap(i, j int) {
+	d.Values[i], d.Values[j] = d.Values[j], d.Values[i]
+	d.Terms[i], d.Terms[j] = d.Terms[j], d.Terms[i]
+}
+
+// matchTerms 返回以 prefix 开头且满足 match 的词项 id，match 为 nil 时不检查
+func (seg *segment) matchTerms(field string, prefix string, match func(string) bool) []int {
+	d, ok := seg.dict(field)
+	if !ok {
+		return nil
+	}
+	res := []int{}
+	for i := sort.SearchStrings(d.Values, prefix); i < len(d.Values); i++ {
+		v := d.Values[i]
+		if !strings.HasPrefix(v, prefix) {
+			break
+		}
+		if match == nil || match(v) {
+			res = append(res, d.Terms[i])
+		}
+	}
+	return res
+}
+
+// 词项较少时逐个合并，较多时直接收集全部 docId 排序
+const unionMergeLimit = 8
+
+// unionTerms 返回包含任一词项的文档，不计算相关度
+func (seg *segment) unionTerms(tids []int) docIterator {
+	if len(tids) == 0 {
+		return &emptyIterator{-1}
+	}
+	if len(tids) <= unionMergeLimit {
+		its := []docIterator{}
+		for _, tid := range tids {
+			its = append(its, newListIterator(seg.indexes[tid]))
+		}
+		return newDisjunction(its, 1)
+	}
+	docs := []int{}
+	for _, tid := range tids {
+		it := newListIterator(seg.indexes[tid])
+		for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+			docs = append(docs, d)
+		}
+	}
+	sort.Ints(docs)
+	return newSliceIterator(docs)
+}
+
+// PrefixQuery 查询以 Prefix 开头的词
+type PrefixQuery struct {
+	Field  string
+	Prefix string
+}
+
+func (q *PrefixQuery) Match(t *Term) bool {
+	return t.Field == q.Field && strings.HasPrefix(t.Value, q.Prefix)
+}
+
+func (q *PrefixQuery) iterator(s *Searcher, seg *segment) docIterator {
+	return seg.unionTerms(seg.matchTerms(q.Field, s.normalize(q.Field, q.Prefix), nil))
+}
+
+func (q *PrefixQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+// WildcardQuery 查询匹配通配符的词，* 匹配任意个字符，? 匹配一个字符
+type WildcardQuery struct {
+	Field   string
+	Pattern string
+}
+
+func (q *WildcardQuery) Match(t *Term) bool {
+	return t.Field == q.Field && wildcardMatch([]rune(q.Pattern), []rune(t.Value))
+}
+
+func (q *WildcardQuery) iterator(s *Searcher, seg *segment) docIterator {
+	pattern := s.normalize(q.Field, q.Pattern)
+	prefix := pattern
+	if i := strings.IndexAny(prefix, "*?"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	p := []rune(pattern)
+	return seg.unionTerms(seg.matchTerms(q.Field, prefix, func(v string) bool {
+		return wildcardMatch(p, []rune(v))
+	}))
+}
+
+func (q *WildcardQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+func wildcardMatch(p []rune, v []rune) bool {
+	// star 为最近一个 * 的位置，mark 为该 * 匹配到的 v 的位置
+	i, j, star, mark := 0, 0, -1, 0
+	for j < len(v) {
+		if i < len(p) && (p[i] == '?' || p[i] == v[j]) {
+			i++
+			j++
+		} else if i < len(p) && p[i] == '*' {
+			star, mark = i, j
+			i++
+		} else if star >= 0 {
+			i = star + 1
+			mark++
+			j = mark
+		} else {
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// RegexpQuery 查询整个词匹配正则表达式的词
+type RegexpQuery struct {
+	Field  string
+	Regexp *regexp.Regexp
+}
+
+// NewRegexpQuery 编译正则表达式，表达式须匹配整个词
+func NewRegexpQuery(field string, expr string) (*RegexpQuery, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return &RegexpQuery{field, re}, nil
+}
+
+func (q *RegexpQuery) Match(t *Term) bool {
+	return t.Field == q.Field && q.Regexp.MatchString(t.Value)
+}
+
+func (q *RegexpQuery) iterator(s *Searcher, seg *segment) docIterator {
+	prefix, _ := q.Regexp.LiteralPrefix()
+	return seg.unionTerms(seg.matchTerms(q.Field, prefix, q.Regexp.MatchString))
+}
+
+func (q *RegexpQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"sort"
+	"testing"
+)
+
+func multiTermSearcher() *Searcher {
+	s := NewSearcher()
+	for _, terms := range [][]string{
+		{"中国-历史-近代"},
+		{"中国-历史-古代", "文物"},
+		{"中国-地理"},
+		{"中国历史"},
+		{"美国-历史"},
+		{"Chinese history"},
+	} {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&StrSliceField{BaseField{true, "term"}, terms},
+		}})
+	}
+	return s
+}
+
+func TestMultiTermQuery(t *testing.T) {
+	s := multiTermSearcher()
+	re, err := NewRegexpQuery("term", "中国-.+-(古代|近代)")
+	check(t, err)
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&PrefixQuery{"term", "中国-历史"}, []int{0, 1}},
+		{&PrefixQuery{"term", "中国"}, []int{0, 1, 2, 3}},
+		{&PrefixQuery{"term", "日本"}, []int{}},
+		{&PrefixQuery{"none", "中国"}, []int{}},
+		{&WildcardQuery{"term", "*-历史*"}, []int{0, 1, 4}},
+		{&WildcardQuery{"term", "中国-??"}, []int{2}},
+		{&WildcardQuery{"term", "*"}, []int{0, 1, 2, 3, 4, 5}},
+		{&WildcardQuery{"term", "Chinese*y"}, []int{5}},
+		{re, []int{0, 1}},
+		{NewBooleanQuery(&Clause{&PrefixQuery{"term", "中国"}, MUST}, &Clause{&TermQuery{&Term{"term", "文物"}}, MUST_NOT}), []int{0, 2, 3}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 加载后由词典重建有序词表
+	l := saveLoad(t, s)
+	if got := sortedIds(l.Find(&PrefixQuery{"term", "中国-历史"})); !equalIds(got, []int{0, 1}) {
+		t.Errorf("after load: %v", got)
+	}
+}
+
+func TestManyTerms(t *testing.T) {
+	s := NewSearcher()
+	for i := 0; i < 30; i++ {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, i},
+			&StrSliceField{BaseField{true, "term"}, []string{"t" + string(rune('a'+i%20))}},
+		}})
+	}
+	if r := s.Find(&PrefixQuery{"term", "t"}); r.Total != 30 {
+		t.Errorf("total %d, want 30", r.Total)
+	}
+	// 查询后添加的词在下次查询前与已排序的词合并
+	for _, v := range []string{"ta1", "s", "tz", "t"} {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&StrSliceField{BaseField{true, "term"}, []string{v}},
+		}})
+	}
+	if r := s.Find(&PrefixQuery{"term", "ta"}); r.Total != 3 {
+		t.Errorf("ta: total %d, want 3", r.Total)
+	}
+	d, _ := s.cur.dict("term")
+	if d.sorted != len(d.Values) || !sort.StringsAreSorted(d.Values) || len(d.Values) != 24 {
+		t.Errorf("dict not sorted: %v", d.Values)
+	}
+	for i, v := range d.Values {
+		if s.cur.lexicon[Term{"term", v}] != d.Terms[i] {
+			t.Errorf("term %s: id %d", v, d.Terms[i])
+		}
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	cases := []struct {
+		p, v string
+		want bool
+	}{
+		{"a*c", "abbc", true},
+		{"a*c", "abcd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*", "", true},
+		{"**b", "ab", true},
+		{"中*史", "中国近代史", true},
+	}
+	for _, c := range cases {
+		if got := wildcardMatch([]rune(c.p), []rune(c.v)); got != c.want {
+			t.Errorf("%s %s: %v", c.p, c.v, got)
+		}
+	}
+}
+
+func TestParseMultiTerm(t *testing.T) {
+	s := multiTermSearcher()
+	cases := []struct {
+		q    string
+		want []int
+	}{
+		{"中国-历史*", []int{0, 1}},
+		{"term:中国-?? OR 美国*", []int{2, 4}},
+		{"/中国-历史-.{2}/", []int{0, 1}},
+		{`/Chinese\/?.*/`, []int{5}},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q, "term")
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		if got := sortedIds(s.Find(q)); !equalIds(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.q, got, c.want)
+		}
+	}
+	if _, ok := mustParse(t, "中国*").(*PrefixQuery); !ok {
+		t.Errorf("expect PrefixQuery")
+	}
+	for _, q := range []string{"/中国(/", "/中国"} {
+		if _, err := ParseQuery(q, "term"); err == nil {
+			t.Errorf("%s: expect error", q)
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) Query {
+	q, err := ParseQuery(s, "term")
+	check(t, err)
+	return q
+}
@@ -0,0 +1,355 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota
+	tokPhrase tokenKind = iota
+	tokSymbol tokenKind = iota
+	tokRegexp tokenKind = iota
+	tokEOF    tokenKind = iota
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+	// slop 为短语后 ~N 指定的距离，未指定时为 -1
+	slop int
+}
+
+func (t *token) is(s string) bool {
+	return (t.kind == tokWord || t.kind == tokSymbol) && t.value == s
+}
+
+func (t *token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.value)
+}
+
+const querySymbols = "()[]{}:"
+
+func tokenize(s string) ([]*token, error) {
+	res := []*token{}
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune(querySymbols, c):
+			res = append(res, &token{tokSymbol, string(c), i, -1})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(r) && r[j] != '"' {
+				j++
+			}
+			if j >= len(r) {
+				return nil, &SyntaxError{i, "unterminated quoted string"}
+			}
+			t := &token{tokPhrase, string(r[i+1 : j]), i, -1}
+			i = j + 1
+			if i < len(r) && r[i] == '~' {
+				k := i + 1
+				for k < len(r) && r[k] >= '0' && r[k] <= '9' {
+					k++
+				}
+				if k == i+1 {
+					return nil, &SyntaxError{i, "expected number after \"~\""}
+				}
+				t.slop, _ = strconv.Atoi(string(r[i+1 : k]))
+				i = k
+			}
+			res = append(res, t)
+		case c == '/':
+			j := i + 1
+			for j < len(r) && r[j] != '/' {
+				if r[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(r) {
+				return nil, &SyntaxError{i, "unterminated regular expression"}
+			}
+			res = append(res, &token{tokRegexp, strings.Replace(string(r[i+1:j]), `\/`, "/", -1), i, -1})
+			i = j + 1
+		default:
+			j := i
+			for j < len(r) && !unicode.IsSpace(r[j]) && r[j] != '"' && !strings.ContainsRune(querySymbols, r[j]) {
+				j++
+			}
+			res = append(res, &token{tokWord, string(r[i:j]), i, -1})
+			i = j
+		}
+	}
+	res = append(res, &token{tokEOF, "", len(r), -1})
+	return res, nil
+}
+
+type parser struct {
+	tokens       []*token
+	cur          int
+	defaultField string
+}
+
+// ParseQuery 将查询字符串解析为 Query，语法：
+//
+//	field:value            词项查询，省略 field 时使用 defaultField
+//	field:"a b"            短语查询，a、b 须依次相邻出现
+//	field:"a b"~N          a、b 相隔不超过 N 个位置，不限顺序
+//	field:中国*            前缀查询，值中含 * 或 ? 时为通配符查询
+//	field:/中国.+史/       正则表达式查询，须匹配整个词
+//	field:value~, value~N  模糊查询，N 为允许的编辑距离
+//	field:[1950 TO 1960]   数值范围，[ ] 包含边界，{ } 不包含边界，* 表示不限
+//	a AND b, a b           同时满足
+//	a OR b                 满足其一
+//	a NOT b, a AND NOT b   满足 a 且不满足 b
+//	( ... )                分组
+//
+// 优先级 NOT/AND 高于 OR
+func ParseQuery(s string, defaultField string) (Query, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, defaultField: defaultField}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{0, "empty query"}
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{t.pos, "unexpected " + t.String()}
+	}
+	return q, nil
+}
+
+func (p *parser) peek() *token {
+	return p.tokens[p.cur]
+}
+
+func (p *parser) next() *token {
+	t := p.tokens[p.cur]
+	if t.kind != tokEOF {
+		p.cur++
+	}
+	return t
+}
+
+func (p *parser) expect(s string) (*token, error) {
+	t := p.next()
+	if !t.is(s) {
+		return nil, &SyntaxError{t.pos, fmt.Sprintf("expected %q, got %s", s, t)}
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (Query, error) {
+	q, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is("OR") {
+		return q, nil
+	}
+	bq := NewBooleanQuery(&Clause{q, SHOULD})
+	for p.peek().is("OR") {
+		p.next()
+		q, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		bq.Add(q, SHOULD)
+	}
+	return bq, nil
+}
+
+func (p *parser) parseAnd() (Query, error) {
+	if t := p.peek(); t.is("NOT") {
+		return nil, &SyntaxError{t.pos, "NOT must follow another clause"}
+	}
+	q, err := p.parseClause()
+	if err != nil {
+		return nil, err
+	}
+	bq := NewBooleanQuery(&Clause{q, MUST})
+	for {
+		t := p.peek()
+		occur := MUST
+		if t.is("AND") {
+			p.next()
+			if p.peek().is("NOT") {
+				p.next()
+				occur = MUST_NOT
+			}
+		} else if t.is("NOT") {
+			p.next()
+			occur = MUST_NOT
+		} else if t.kind == tokEOF || t.is("OR") || t.is(")") {
+			break
+		}
+		q, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		bq.Add(q, occur)
+	}
+	if len(bq.Clauses) == 1 {
+		return bq.Clauses[0].Q, nil
+	}
+	return bq, nil
+}
+
+func (p *parser) parseClause() (Query, error) {
+	t := p.next()
+	if t.is("(") {
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.expect(")")
+		if err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+	if t.kind == tokEOF || t.kind == tokSymbol || t.is("AND") || t.is("OR") || t.is("NOT") {
+		return nil, &SyntaxError{t.pos, "unexpected " + t.String()}
+	}
+	field := p.defaultField
+	if p.peek().is(":") {
+		if t.kind != tokWord {
+			return nil, &SyntaxError{t.pos, "field name must not be quoted"}
+		}
+		field = t.value
+		p.next()
+		t = p.next()
+		if t.is("[") || t.is("{") {
+			return p.parseRange(field, t)
+		}
+		if t.kind != tokWord && t.kind != tokPhrase && t.kind != tokRegexp {
+			return nil, &SyntaxError{t.pos, "expected value after " + strconv.Quote(field+":")}
+		}
+	}
+	if field == "" {
+		return nil, &SyntaxError{t.pos, "missing field name"}
+	}
+	switch {
+	case t.kind == tokPhrase:
+		return phraseQuery(field, t), nil
+	case t.kind == tokRegexp:
+		q, err := NewRegexpQuery(field, t.value)
+		if err != nil {
+			return nil, &SyntaxError{t.pos, "invalid regular expression: " + err.Error()}
+		}
+		return q, nil
+	case strings.ContainsAny(t.value, "*?"):
+		return wildcardQuery(field, t.value), nil
+	}
+	if q, ok := fuzzyQuery(field, t.value); ok {
+		if fq, ok := q.(*FuzzyQuery); ok && fq.MaxEdits > fuzzyMaxEdits {
+			return nil, &SyntaxError{t.pos, fmt.Sprintf("edit distance must be at most %d", fuzzyMaxEdits)}
+		}
+		return q, nil
+	}
+	return &TermQuery{&Term{field, t.value}}, nil
+}
+
+// fuzzyQuery 解析 value~ 及 value~N
+func fuzzyQuery(field string, v string) (Query, bool) {
+	i := strings.LastIndex(v, "~")
+	if i <= 0 {
+		return nil, false
+	}
+	q := &FuzzyQuery{Field: field, Value: v[:i]}
+	if i+1 < len(v) {
+		n, err := strconv.Atoi(v[i+1:])
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		if n == 0 {
+			return &TermQuery{&Term{field, q.Value}}, true
+		}
+		q.MaxEdits = n
+	}
+	return q, true
+}
+
+// wildcardQuery 只在末尾有一个 * 时返回 PrefixQuery
+func wildcardQuery(field string, v string) Query {
+	prefix := strings.TrimSuffix(v, "*")
+	if prefix != v && !strings.ContainsAny(prefix, "*?") {
+		return &PrefixQuery{field, prefix}
+	}
+	return &WildcardQuery{field, v}
+}
+
+func phraseQuery(field string, t *token) Query {
+	terms := strings.Fields(t.value)
+	if t.slop >= 0 {
+		return &SpanNearQuery{Field: field, Terms: terms, Slop: t.slop}
+	}
+	if len(terms) == 1 {
+		return &TermQuery{&Term{field, terms[0]}}
+	}
+	return &PhraseQuery{field, terms}
+}
+
+func (p *parser) rangeBound(t *token) (int, bool, error) {
+	if t.is("*") {
+		return 0, true, nil
+	}
+	if t.kind != tokWord {
+		return 0, false, &SyntaxError{t.pos, "expected number, got " + t.String()}
+	}
+	v, err := strconv.Atoi(t.value)
+	if err != nil {
+		return 0, false, &SyntaxError{t.pos, "expected number, got " + t.String()}
+	}
+	return v, false, nil
+}
+
+func (p *parser) parseRange(field string, open *token) (Query, error) {
+	q := &RangeQuery{Field: field, MinExclusive: open.is("{")}
+	var err error
+	q.Min, q.NoMin, err = p.rangeBound(p.next())
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.expect("TO")
+	if err != nil {
+		return nil, err
+	}
+	q.Max, q.NoMax, err = p.rangeBound(p.next())
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if !t.is("]") && !t.is("}") {
+		return nil, &SyntaxError{t.pos, "expected \"]\" or \"}\", got " + t.String()}
+	}
+	q.MaxExclusive = t.is("}")
+	return q, nil
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"sort"
+	"testing"
+)
+
+func testSearcher() *Searcher {
+	s := NewSearcher()
+	add := func(year int, terms ...string) {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&IntField{BaseField{true, "year"}, year},
+			&StrSliceField{BaseField{true, "term"}, terms},
+		}})
+	}
+	add(1949, "北京", "历史")
+	add(1950, "北京", "上海")
+	add(1955, "北京", "地理")
+	add(1960, "上海", "历史")
+	add(1960, "北京", "历史")
+	add(1970, "北京")
+	return s
+}
+
+func ids(r *SearchResult) []int {
+	res := []int{}
+	for _, d := range r.Docs {
+		res = append(res, d.Fields[0].GetValue().(int))
+	}
+	return res
+}
+
+// sortedIds 按 docId 顺序返回结果，用于只关心匹配集合的测试
+func sortedIds(r *SearchResult) []int {
+	res := ids(r)
+	sort.Ints(res)
+	return res
+}
+
+func equalIds(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseQuery(t *testing.T) {
+	s := testSearcher()
+	cases := []struct {
+		q    string
+		want []int
+	}{
+		{"term:北京", []int{0, 1, 2, 4, 5}},
+		{"北京 历史", []int{0, 4}},
+		{"term:北京 AND year:[1950 TO 1960] NOT term:上海", []int{2, 4}},
+		{"term:北京 AND year:{1950 TO 1960}", []int{2}},
+		{"year:[1960 TO *]", []int{3, 4, 5}},
+		{"year:[* TO 1950}", []int{0}},
+		{"地理 OR 上海 AND NOT 北京", []int{2, 3}},
+		{"(地理 OR 上海) AND NOT 北京", []int{3}},
+		{`term:"历史"`, []int{0, 3, 4}},
+		{"term:南京", []int{}},
+		{"term:南京 AND term:北京", []int{}},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q, "term")
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		if got := sortedIds(s.Find(q)); !equalIds(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.q, got, c.want)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	cases := []struct {
+		q   string
+		pos int
+	}{
+		{"", 0},
+		{"NOT 北京", 0},
+		{"北京 AND", 6},
+		{"(北京 OR 上海", 9},
+		{"year:[1950 1960]", 11},
+		{"year:[a TO 1960]", 6},
+		{`term:"北京`, 5},
+		{"北京 )", 3},
+		{"上海 OR 北京~3", 6},
+	}
+	for _, c := range cases {
+		_, err := ParseQuery(c.q, "term")
+		se, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%s: expect syntax error, got %v", c.q, err)
+			continue
+		}
+		if se.Pos != c.pos {
+			t.Errorf("%s: %v, want position %d", c.q, se, c.pos)
+		}
+	}
+}
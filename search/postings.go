@@ -0,0 +1,176 @@
+package search
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// 每 blockSize 个文档记录一个跳跃点
+const blockSize = 128
+
+// Index 为词项或查询结果的倒排表，docId 按递增顺序保存，分页结果的 Size 为分页前的总数。
+// docs 中每个文档为与前一个 docId 的差值左移一位，词频为 1 时最低位为 1，
+// 否则其后为词频；positions 中每个文档依次为词频个位置的差值，均为 varint 编码。
+// positions 为空时不记录位置
+type Index struct {
+	Size      int
+	last      int
+	docs      []byte
+	positions []byte
+	skips     []skipEntry
+}
+
+// skipEntry 为一块的最后一个 docId 及下一块在 docs、positions 中的偏移
+type skipEntry struct {
+	Doc    int
+	DocOff int
+	PosOff int
+}
+
+// add 在末尾添加文档，doc 须大于已有的 docId，否则忽略
+func (i *Index) add(doc int, freq int, positions []int) {
+	if i.Size > 0 && doc <= i.last {
+		return
+	}
+	v := uint64(doc-i.last) << 1
+	if freq == 1 {
+		i.docs = appendUvarint(i.docs, v|1)
+	} else {
+		i.docs = appendUvarint(i.docs, v)
+		i.docs = appendUvarint(i.docs, uint64(freq))
+	}
+	p := 0
+	for _, pos := range positions {
+		i.positions = appendUvarint(i.positions, uint64(pos-p))
+		p = pos
+	}
+	i.last = doc
+	i.Size++
+	if i.Size%blockSize == 0 {
+		i.skips = append(i.skips, skipEntry{doc, len(i.docs), len(i.positions)})
+	}
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// skipUvarints 返回 off 之后跳过 n 个 varint 的偏移
+func skipUvarints(b []byte, off int, n int) int {
+	for ; n > 0; off++ {
+		if b[off] < 0x80 {
+			n--
+		}
+	}
+	return off
+}
+
+// listIterator 依次解码倒排表，advance 先通过跳跃点找到目标所在的块
+type listIterator struct {
+	idx *Index
+	doc int
+	// n 为已读取的文档数，off 为下一个文档在 docs 中的偏移
+	n    int
+	off  int
+	freq int
+	// posOff 之后还有 pending 个位置属于之前的文档，pos 为当前文档已解码的位置
+	posOff  int
+	pending int
+	pos     []int
+	// scorer 为 nil 时不计算相关度
+	scorer *termScorer
+}
+
+func newListIterator(i *Index) docIterator {
+	if i == nil || len(i.docs) == 0 {
+		return &emptyIterator{-1}
+	}
+	return &listIterator{idx: i, doc: -1}
+}
+
+func (it *listIterator) docID() int {
+	return it.doc
+}
+
+func (it *listIterator) nextDoc() int {
+	if it.doc == noMoreDocs {
+		return it.doc
+	}
+	if it.off >= len(it.idx.docs) {
+		it.doc = noMoreDocs
+		return it.doc
+	}
+	base := it.doc
+	if it.n == 0 {
+		base = 0
+	}
+	if it.n > 0 && it.pos == nil {
+		it.pending += it.freq
+	}
+	v, k := binary.Uvarint(it.idx.docs[it.off:])
+	it.off += k
+	it.freq = 1
+	if v&1 == 0 {
+		f, k := binary.Uvarint(it.idx.docs[it.off:])
+		it.off += k
+		it.freq = int(f)
+	}
+	it.doc = base + int(v>>1)
+	it.n++
+	it.pos = nil
+	return it.doc
+}
+
+func (it *listIterator) advance(target int) int {
+	if it.doc >= target {
+		return it.doc
+	}
+	skips := it.idx.skips
+	// b 为 target 所在的块，跳过当前位置与该块之间的所有块
+	b := sort.Search(len(skips), func(j int) bool {
+		return skips[j].Doc >= target
+	})
+	if b > 0 && b*blockSize > it.n {
+		sk := skips[b-1]
+		it.doc, it.n, it.off, it.freq = sk.Doc, b*blockSize, sk.DocOff, 0
+		it.posOff, it.pending, it.pos = sk.PosOff, 0, nil
+	}
+	for it.doc < target {
+		it.nextDoc()
+	}
+	return it.doc
+}
+
+func (it *listIterator) cost() int {
+	return it.idx.Size
+}
+
+func (it *listIterator) score() float64 {
+	if it.scorer == nil || it.doc < 0 || it.doc == noMoreDocs {
+		return 0
+	}
+	return it.scorer.score(it.doc, it.freq)
+}
+
+// positions 返回当前文档中词项的位置，倒排表不记录位置时返回 nil
+func (it *listIterator) positions() []int {
+	if it.doc < 0 || it.doc == noMoreDocs || len(it.idx.positions) == 0 {
+		return nil
+	}
+	if it.pos == nil {
+		ps := it.idx.positions
+		it.posOff = skipUvarints(ps, it.posOff, it.pending)
+		it.pending = 0
+		it.pos = make([]int, it.freq)
+		p := 0
+		for j := range it.pos {
+			v, k := binary.Uvarint(ps[it.posOff:])
+			it.posOff += k
+			p += int(v)
+			it.pos[j] = p
+		}
+	}
+	return it.pos
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"testing"
+)
+
+// testPostings 返回 n 个文档的倒排表，docId 为 3 的倍数，第 i 个文档的词频为 i%3+1
+func testPostings(n int) *Index {
+	idx := &Index{}
+	for i := 0; i < n; i++ {
+		pos := []int{}
+		for j := 0; j <= i%3; j++ {
+			pos = append(pos, i+j*5)
+		}
+		idx.add(i*3, len(pos), pos)
+	}
+	return idx
+}
+
+func TestPostingsNextDoc(t *testing.T) {
+	n := blockSize*3 + 7
+	idx := testPostings(n)
+	if idx.Size != n || len(idx.skips) != 3 {
+		t.Fatalf("size %d, %d skips", idx.Size, len(idx.skips))
+	}
+	it := newListIterator(idx).(*listIterator)
+	for i := 0; i < n; i++ {
+		if d := it.nextDoc(); d != i*3 || it.freq != i%3+1 {
+			t.Fatalf("doc %d: %d freq %d", i, d, it.freq)
+		}
+		// 只读取部分文档的位置
+		if i%5 == 0 {
+			if ps := it.positions(); len(ps) != i%3+1 || ps[len(ps)-1] != i+(i%3)*5 {
+				t.Fatalf("doc %d positions: %v", i, ps)
+			}
+		}
+	}
+	if d := it.nextDoc(); d != noMoreDocs {
+		t.Errorf("after last: %d", d)
+	}
+}
+
+func TestPostingsAdvance(t *testing.T) {
+	idx := testPostings(blockSize*4 + 1)
+	cases := []struct {
+		targets []int
+		want    []int
+	}{
+		{[]int{0, 1, 2}, []int{0, 3, 3}},
+		// 跳过整块
+		{[]int{blockSize * 3 * 2, blockSize*3*2 + 1}, []int{blockSize * 3 * 2, blockSize*3*2 + 3}},
+		{[]int{blockSize*3 - 1, blockSize * 3 * 3}, []int{blockSize * 3, blockSize * 3 * 3}},
+		{[]int{blockSize * 3 * 4}, []int{blockSize * 3 * 4}},
+		{[]int{5, blockSize*3*4 + 1}, []int{6, noMoreDocs}},
+	}
+	for i, c := range cases {
+		it := newListIterator(idx).(*listIterator)
+		for j, target := range c.targets {
+			d := it.advance(target)
+			if d != c.want[j] {
+				t.Errorf("case %d: advance(%d) = %d, want %d", i, target, d, c.want[j])
+				break
+			}
+			if d == noMoreDocs {
+				continue
+			}
+			k := d / 3
+			if ps := it.positions(); len(ps) != k%3+1 || ps[0] != k {
+				t.Errorf("case %d: doc %d positions %v", i, d, ps)
+			}
+		}
+	}
+}
+
+func TestPostingsConjunction(t *testing.T) {
+	s := NewSearcher()
+	n := 1000
+	for i := 0; i < n; i++ {
+		terms := []string{"common"}
+		if i%97 == 0 {
+			terms = append(terms, "rare")
+		}
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, i},
+			&StrSliceField{BaseField{true, "term"}, terms},
+		}})
+	}
+	q := NewBooleanQuery(&Clause{termQuery("common"), MUST}, &Clause{termQuery("rare"), MUST})
+	want := []int{}
+	for i := 0; i < n; i += 97 {
+		want = append(want, i)
+	}
+	if got := sortedIds(s.Find(q)); !equalIds(got, want) {
+		t.Errorf("common AND rare: %v, want %v", got, want)
+	}
+	l := saveLoad(t, s)
+	if got := sortedIds(l.Find(q)); !equalIds(got, want) {
+		t.Errorf("after load: %v, want %v", got, want)
+	}
+	if r := l.Find(termQuery("common")); r.Total != n {
+		t.Errorf("common after load: %d", r.Total)
+	}
+	if r := l.Find(&PageQuery{&PageQuery{termQuery("common"), 0, blockSize + 1}, 0, 0}); r.Total != blockSize+1 {
+		t.Errorf("nested page: %d, want %d", r.Total, blockSize+1)
+	}
+}
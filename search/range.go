@@ -0,0 +1,135 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+)
+
+// RangeQuery 查询 IntField 的值在 [Min, Max] 范围内的文档，
+// MinExclusive、MaxExclusive 表示不包含边界，NoMin、NoMax 表示不限下界、上界
+type RangeQuery struct {
+	Field        string
+	Min          int
+	Max          int
+	MinExclusive bool
+	MaxExclusive bool
+	NoMin        bool
+	NoMax        bool
+}
+
+func (q *RangeQuery) contains(v int) bool {
+	if !q.NoMin && (v < q.Min || (q.MinExclusive && v == q.Min)) {
+		return false
+	}
+	if !q.NoMax && (v > q.Max || (q.MaxExclusive && v == q.Max)) {
+		return false
+	}
+	return true
+}
+
+func (q *RangeQuery) Match(t *Term) bool {
+	if t.Field != q.Field {
+		return false
+	}
+	v, err := strconv.Atoi(t.Value)
+	return err == nil && q.contains(v)
+}
+
+// numericIndex 按数值排序保存 IntField 的所有取值及对应的词项 id，
+// 前 sorted 个已排序，与 termDict 相同
+type numericIndex struct {
+	Values []int
+	Terms  []int
+	sorted int
+}
+
+// addNumeric 只追加取值，调用者保证同一字段的取值不重复
+func (seg *segment) addNumeric(field string, v int, tid int) {
+	ni, ok := seg.numeric[field]
+	if !ok {
+		ni = &numericIndex{}
+		seg.numeric[field] = ni
+	}
+	ni.Values = append(ni.Values, v)
+	ni.Terms = append(ni.Terms, tid)
+}
+
+// numericIndex 返回排序后的 numericIndex，与 dict 相同由 dictMu 保护排序
+func (seg *segment) numericIndex(field string) (*numericIndex, bool) {
+	seg.dictMu.Lock()
+	defer seg.dictMu.Unlock()
+	ni, ok := seg.numeric[field]
+	if ok {
+		ni.sort()
+	}
+	return ni, ok
+}
+
+// sort 将新添加的取值排序后与已排序的取值合并
+func (ni *numericIndex) sort() {
+	if ni.sorted == len(ni.Values) {
+		return
+	}
+	sort.Sort(&numericIndex{Values: ni.Values[ni.sorted:], Terms: ni.Terms[ni.sorted:]})
+	values, terms := make([]int, 0, len(ni.Values)), make([]int, 0, len(ni.Terms))
+	i, j := 0, ni.sorted
+	for i < ni.sorted || j < len(ni.Values) {
+		if j == len(ni.Values) || i < ni.sorted && ni.Values[i] < ni.Values[j] {
+			values, terms = append(values, ni.Values[i]), append(terms, ni.Terms[i])
+			i++
+		} else {
+			values, terms = append(values, ni.Values[j]), append(terms, ni.Terms[j])
+			j++
+		}
+	}
+	ni.Values, ni.Terms, ni.sorted = values, terms, len(values)
+}
+
+func (ni *numericIndex) Len() int {
+	return len(ni.Values)
+}
+
+func (ni *numericIndex) Less(i, j int) bool {
+	return ni.Values[i] < ni.Values[j]
+}
+
+func (ni *numericIndex) Swap(i, j int) {
+	ni.Values[i], ni.Values[j] = ni.Values[j], ni.Values[i]
+	ni.Terms[i], ni.Terms[j] = ni.Terms[j], ni.Terms[i]
+}
+
+// bounds 返回范围内取值在 Values 中的下标区间 [lo, hi)
+func (q *RangeQuery) bounds(ni *numericIndex) (int, int) {
+	lo, hi := 0, len(ni.Values)
+	if !q.NoMin {
+		min := q.Min
+		if q.MinExclusive {
+			min++
+		}
+		lo = sort.SearchInts(ni.Values, min)
+	}
+	if !q.NoMax {
+		max := q.Max
+		if !q.MaxExclusive {
+			max++
+		}
+		hi = sort.SearchInts(ni.Values, max)
+	}
+	return lo, hi
+}
+
+func (q *RangeQuery) iterator(s *Searcher, seg *segment) docIterator {
+	ni, ok := seg.numericIndex(q.Field)
+	if !ok {
+		return &emptyIterator{-1}
+	}
+	lo, hi := q.bounds(ni)
+	if lo >= hi {
+		return &emptyIterator{-1}
+	}
+	return seg.unionTerms(ni.Terms[lo:hi])
+}
+
+func (q *RangeQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
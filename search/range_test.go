@@ -0,0 +1,58 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRangeQuery(t *testing.T) {
+	s := testSearcher()
+	cases := []struct {
+		q    *RangeQuery
+		want []int
+	}{
+		{&RangeQuery{Field: "year", Min: 1950, Max: 1960}, []int{1, 2, 3, 4}},
+		{&RangeQuery{Field: "year", Min: 1950, Max: 1960, MinExclusive: true}, []int{2, 3, 4}},
+		{&RangeQuery{Field: "year", Min: 1950, Max: 1960, MaxExclusive: true}, []int{1, 2}},
+		{&RangeQuery{Field: "year", Max: 1955, NoMin: true}, []int{0, 1, 2}},
+		{&RangeQuery{Field: "year", Min: 1956, NoMax: true}, []int{3, 4, 5}},
+		{&RangeQuery{Field: "year", NoMin: true, NoMax: true}, []int{0, 1, 2, 3, 4, 5}},
+		{&RangeQuery{Field: "year", Min: 1961, Max: 1969}, []int{}},
+		{&RangeQuery{Field: "year", Min: 1960, Max: 1950}, []int{}},
+		{&RangeQuery{Field: "none", NoMin: true, NoMax: true}, []int{}},
+	}
+	for _, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("%+v: %v, want %v", c.q, got, c.want)
+		}
+	}
+}
+
+func TestRangeQueryManyValues(t *testing.T) {
+	s := NewSearcher()
+	// 年份倒序添加，确保数值索引的顺序与添加顺序无关
+	for i := 0; i < 100; i++ {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, i},
+			&IntField{BaseField{true, "year"}, 2000 - i%50},
+		}})
+	}
+	q := &RangeQuery{Field: "year", Min: 1960, Max: 1990}
+	r := s.Find(q)
+	if r.Total != 62 {
+		t.Errorf("total %d, want 62", r.Total)
+	}
+	got := ids(r)
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Fatalf("docs not in order: %v", got)
+		}
+	}
+	var buf bytes.Buffer
+	check(t, s.Save(&buf))
+	l, err := Load(&buf)
+	check(t, err)
+	if got := ids(l.Find(q)); !equalIds(got, ids(r)) {
+		t.Errorf("after load: %v, want %v", got, ids(r))
+	}
+}
@@ -0,0 +1,272 @@
+package search
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// BM25 相关度参数，K1 控制词频饱和速度，B 控制字段长度归一化程度
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+var DefaultBM25 = BM25{1.2, 0.75}
+
+// SetBM25 修改相关度参数，对之后的查询生效
+func (s *Searcher) SetBM25(p BM25) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bm25 = p
+}
+
+// fieldStats 为包含字段的文档数及字段的总词项数
+type fieldStats struct {
+	Docs   int
+	Length int
+}
+
+func (s *Searcher) addNorm(field string, doc int, n int) {
+	norms := s.norms[field]
+	for len(norms) <= doc {
+		norms = append(norms, 0)
+	}
+	norms[doc] = n
+	s.norms[field] = norms
+	st, ok := s.stats[field]
+	if !ok {
+		st = &fieldStats{}
+		s.stats[field] = st
+	}
+	st.Docs++
+	st.Length += n
+}
+
+// termScorer 计算一个词项在各文档中的 BM25 得分
+type termScorer struct {
+	idf    float64
+	avgLen float64
+	norms  []int
+	p      BM25
+	// boost 为得分的权重，模糊查询中与原词差别越大权重越低
+	boost float64
+}
+
+// termScorer 返回字段 field 中包含词项的文档数为 df 时的计分器
+func (s *Searcher) termScorer(field string, df int) *termScorer {
+	st, ok := s.stats[field]
+	if !ok || st.Docs == 0 {
+		return nil
+	}
+	n := float64(st.Docs)
+	return &termScorer{
+		idf:    math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5)),
+		avgLen: float64(st.Length) / n,
+		norms:  s.norms[field],
+		p:      s.bm25,
+		boost:  1,
+	}
+}
+
+func (t *termScorer) score(doc int, freq int) float64 {
+	if freq <= 0 {
+		freq = 1
+	}
+	l := 0.0
+	if doc < len(t.norms) {
+		l = float64(t.norms[doc])
+	}
+	tf := float64(freq)
+	norm := t.p.K1 * (1 - t.p.B + t.p.B*l/t.avgLen)
+	return t.boost * t.idf * tf * (t.p.K1 + 1) / (tf + norm)
+}
+
+// SortField 按字段值排序，Field 为空时按相关度排序
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+var SortByScore = SortField{"", true}
+
+// ParseSort 解析排序说明，如 "year desc, name asc"，各项以逗号分隔，默认升序；
+// score 或 relevance 表示按相关度排序，默认降序
+func ParseSort(spec string) ([]SortField, error) {
+	res := []SortField{}
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Fields(item)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid sort %q", strings.TrimSpace(item))
+		}
+		f := SortField{parts[0], false}
+		if f.Field == "score" || f.Field == "relevance" {
+			f = SortByScore
+		}
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+				f.Desc = false
+			case "desc":
+				f.Desc = true
+			default:
+				return nil, fmt.Errorf("invalid sort order %q", parts[1])
+			}
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// hit 为一个结果，values 为排序字段的值，与排序的 fields 一一对应
+type hit struct {
+	doc    int
+	score  float64
+	values []interface{}
+}
+
+// collect 收集匹配的文档并依次按 fields 排序，最后按 docId 排序；fields 为空时按相关度降序。
+// n > 0 时只用大小为 n 的堆保留排在前面的 n 个结果，返回保留的结果及匹配的文档总数。
+// 收集时从 doc values 中取出各结果的字段值
+func (s *Searcher) collect(it docIterator, fields []SortField, n int) ([]*hit, int) {
+	if len(fields) == 0 {
+		fields = []SortField{SortByScore}
+	}
+	h := &hitHeap{fields: fields}
+	total := 0
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		total++
+		x := &hit{doc: d, score: it.score(), values: make([]interface{}, len(fields))}
+		for i, f := range fields {
+			if f.Field != "" {
+				x.values[i] = s.docValue(d, f.Field)
+			}
+		}
+		switch {
+		case n <= 0:
+			h.hits = append(h.hits, x)
+		case len(h.hits) < n:
+			heap.Push(h, x)
+		case hitLess(x, h.hits[0], fields):
+			h.hits[0] = x
+			heap.Fix(h, 0)
+		}
+	}
+	sort.Slice(h.hits, func(i, j int) bool {
+		return hitLess(h.hits[i], h.hits[j], fields)
+	})
+	return h.hits, total
+}
+
+// hitLess 判断结果 a 是否排在 b 之前
+func hitLess(a *hit, b *hit, fields []SortField) bool {
+	for k, f := range fields {
+		c, missing := compareHits(a, b, k, f.Field)
+		if c == 0 {
+			continue
+		}
+		if f.Desc && !missing {
+			return c > 0
+		}
+		return c < 0
+	}
+	return a.doc < b.doc
+}
+
+// hitHeap 的堆顶为保留的结果中排在最后的一个
+type hitHeap struct {
+	hits   []*hit
+	fields []SortField
+}
+
+func (h *hitHeap) Len() int {
+	return len(h.hits)
+}
+
+func (h *hitHeap) Less(i, j int) bool {
+	return hitLess(h.hits[j], h.hits[i], h.fields)
+}
+
+func (h *hitHeap) Swap(i, j int) {
+	h.hits[i], h.hits[j] = h.hits[j], h.hits[i]
+}
+
+func (h *hitHeap) Push(x interface{}) {
+	h.hits = append(h.hits, x.(*hit))
+}
+
+func (h *hitHeap) Pop() interface{} {
+	x := h.hits[len(h.hits)-1]
+	h.hits = h.hits[:len(h.hits)-1]
+	return x
+}
+
+// compareHits 比较两个结果的相关度或第 k 个排序字段的值，missing 表示其中一个缺少字段值
+func compareHits(a *hit, b *hit, k int, field string) (int, bool) {
+	if field == "" {
+		switch {
+		case a.score < b.score:
+			return -1, false
+		case a.score > b.score:
+			return 1, false
+		}
+		return 0, false
+	}
+	av, bv := a.values[k], b.values[k]
+	return compareValues(av, bv), av == nil || bv == nil
+}
+
+// compareValues 比较 int 或 string 值，缺少值的排在最后
+func compareValues(a interface{}, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		}
+		return -1
+	}
+	switch av := a.(type) {
+	case int:
+		if bv, ok := b.(int); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	}
+	return 0
+}
+
+// unwrapPage 取出查询的分页参数，返回不分页的查询
+func unwrapPage(q Query) (Query, int, int) {
+	switch pq := q.(type) {
+	case *PageQuery:
+		inner, start, limit := unwrapPage(pq.Q)
+		if start != 0 || limit != 0 {
+			// 嵌套分页无法在排序后合并，按原方式执行
+			return q, 0, 0
+		}
+		return inner, pq.Start, pq.Limit
+	case *TermPageQuery:
+		return &TermQuery{pq.T}, pq.Start, pq.Limit
+	case *BooleanQuery:
+		if pq.Start == 0 && pq.Limit == 0 {
+			return q, 0, 0
+		}
+		bq := *pq
+		bq.Start, bq.Limit = 0, 0
+		return &bq, pq.Start, pq.Limit
+	}
+	return q, 0, 0
+}
@@ -0,0 +1,216 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+)
+
+func scoreSearcher() *Searcher {
+	s := NewSearcher()
+	add := func(year int, name string, terms ...string) {
+		fields := []Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&IntField{BaseField{true, "year"}, year},
+			&StrSliceField{BaseField{true, "term"}, terms},
+		}
+		if name != "" {
+			fields = append(fields, &StrSliceField{BaseField{false, "name"}, []string{name}})
+		}
+		s.Add(&Document{fields})
+	}
+	add(1950, "c", "北京", "历史", "地理", "人物")
+	add(1960, "a", "北京", "北京", "历史")
+	add(1940, "b", "北京", "人物")
+	add(1970, "", "上海", "历史")
+	return s
+}
+
+func TestBM25(t *testing.T) {
+	s := scoreSearcher()
+	r := s.Find(termQuery("北京"))
+	// 文档 1 词频高，文档 2 比文档 0 字段短
+	if got := ids(r); !equalIds(got, []int{1, 2, 0}) {
+		t.Errorf("北京: %v, want [1 2 0]", got)
+	}
+	if len(r.Scores) != len(r.Docs) {
+		t.Fatalf("%d scores for %d docs", len(r.Scores), len(r.Docs))
+	}
+	for i := 1; i < len(r.Scores); i++ {
+		if r.Scores[i] > r.Scores[i-1] || r.Scores[i] <= 0 {
+			t.Errorf("scores not descending: %v", r.Scores)
+		}
+	}
+	// 上海 比 历史 少见，同时匹配时得分更高
+	r = s.Find(NewBooleanQuery(&Clause{termQuery("上海"), SHOULD}, &Clause{termQuery("历史"), SHOULD}))
+	if got := ids(r); got[0] != 3 {
+		t.Errorf("上海 OR 历史: %v, want 3 first", got)
+	}
+	// SHOULD 子句影响相关度但不影响匹配
+	r = s.Find(NewBooleanQuery(&Clause{termQuery("历史"), MUST}, &Clause{termQuery("北京"), SHOULD}))
+	if got := ids(r); !equalIds(got, []int{1, 0, 3}) {
+		t.Errorf("历史 +北京: %v, want [1 0 3]", got)
+	}
+	// 范围查询不计算相关度
+	r = s.Find(&RangeQuery{Field: "year", NoMin: true, NoMax: true})
+	if got := ids(r); !equalIds(got, []int{0, 1, 2, 3}) || r.Scores[0] != 0 {
+		t.Errorf("range: %v %v", got, r.Scores)
+	}
+}
+
+func TestBM25Params(t *testing.T) {
+	s := scoreSearcher()
+	// B 为 0 时不考虑字段长度，词频高的文档仍排在前面，其余按 docId
+	s.SetBM25(BM25{1.2, 0})
+	if got := ids(s.Find(termQuery("北京"))); !equalIds(got, []int{1, 0, 2}) {
+		t.Errorf("b=0: %v, want [1 0 2]", got)
+	}
+	// K1 为 0 时不考虑词频
+	s.SetBM25(BM25{0, 0.75})
+	if got := ids(s.Find(termQuery("北京"))); !equalIds(got, []int{0, 1, 2}) {
+		t.Errorf("k1=0: %v, want [0 1 2]", got)
+	}
+}
+
+func TestFindSorted(t *testing.T) {
+	s := scoreSearcher()
+	q := termQuery("历史")
+	cases := []struct {
+		sort []SortField
+		want []int
+	}{
+		{[]SortField{{"year", false}}, []int{0, 1, 3}},
+		{[]SortField{{"year", true}}, []int{3, 1, 0}},
+		{[]SortField{{"name", false}}, []int{1, 0, 3}},
+		{[]SortField{{"name", true}}, []int{0, 1, 3}},
+		{[]SortField{SortByScore}, ids(s.Find(q))},
+	}
+	for i, c := range cases {
+		if got := ids(s.FindSorted(q, c.sort...)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 排序后再分页
+	r := s.FindSorted(&PageQuery{q, 1, 1}, SortField{"year", true})
+	if r.Total != 3 || !equalIds(ids(r), []int{1}) {
+		t.Errorf("page: total %d, %v", r.Total, ids(r))
+	}
+}
+
+// 分页时只保留前 start+limit 个结果，各页与全部结果排序后分页相同
+func TestFindSortedTopN(t *testing.T) {
+	s := segSearcher(3)
+	q := &RangeQuery{Field: "year", NoMin: true, NoMax: true}
+	for _, spec := range []string{"year desc", "year, name desc", "name", "score"} {
+		order, err := ParseSort(spec)
+		check(t, err)
+		all := ids(s.FindSorted(q, order...))
+		for start := 0; start < len(all); start++ {
+			for limit := 1; limit <= 3; limit++ {
+				r := s.FindSorted(&PageQuery{q, start, limit}, order...)
+				end := start + limit
+				if end > len(all) {
+					end = len(all)
+				}
+				if !equalIds(ids(r), all[start:end]) || r.Total != len(all) {
+					t.Errorf("%s [%d,%d): %v total %d, want %v", spec, start, limit, ids(r), r.Total, all[start:end])
+				}
+			}
+		}
+	}
+}
+
+func TestScoreSaveLoad(t *testing.T) {
+	s := scoreSearcher()
+	buf := &bytes.Buffer{}
+	check(t, s.Save(buf))
+	l, err := Load(buf)
+	check(t, err)
+	before, after := s.Find(termQuery("北京")), l.Find(termQuery("北京"))
+	if !equalIds(ids(after), ids(before)) {
+		t.Fatalf("after load: %v, want %v", ids(after), ids(before))
+	}
+	for i := range before.Scores {
+		if after.Scores[i] != before.Scores[i] {
+			t.Errorf("score %d: %v, want %v", i, after.Scores[i], before.Scores[i])
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []SortField
+	}{
+		{"year desc, name asc", []SortField{{"year", true}, {"name", false}}},
+		{" year ", []SortField{{"year", false}}},
+		{"name DESC,score", []SortField{{"name", true}, SortByScore}},
+		{"relevance asc", []SortField{{"", false}}},
+	}
+	for _, c := range cases {
+		got, err := ParseSort(c.spec)
+		check(t, err)
+		if len(got) != len(c.want) {
+			t.Errorf("%q: %v, want %v", c.spec, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%q: %v, want %v", c.spec, got, c.want)
+				break
+			}
+		}
+	}
+	for _, spec := range []string{"", "year up", "year desc name", "year,,name"} {
+		if _, err := ParseSort(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestSortDocValues(t *testing.T) {
+	order, err := ParseSort("year desc, name asc")
+	check(t, err)
+	q := &RangeQuery{Field: "year", NoMin: true, NoMax: true}
+	want := []int{7, 6, 5, 4, 3, 1, 2, 0}
+	for _, every := range []int{0, 1, 3} {
+		s := segSearcher(every)
+		// 已有的段补充排序字段的 doc values
+		s.SetSortField("year")
+		s.SetSortField("name")
+		for _, seg := range s.searchSegments() {
+			if _, ok := seg.docValues["term"]; ok || len(seg.docValues) != 2 {
+				t.Errorf("every %d: doc values for %d fields", every, len(seg.docValues))
+			}
+		}
+		if got := ids(s.FindSorted(q, order...)); !equalIds(got, want) {
+			t.Errorf("every %d: %v, want %v", every, got, want)
+		}
+		if got := ids(saveLoad(t, s).FindSorted(q, order...)); !equalIds(got, want) {
+			t.Errorf("every %d after load: %v, want %v", every, got, want)
+		}
+		// 压缩后 doc values 随段重新生成
+		s.Delete(idTerm(5))
+		s.Compact()
+		if got := ids(s.FindSorted(q, order...)); !equalIds(got, []int{7, 6, 4, 3, 1, 2, 0}) {
+			t.Errorf("every %d after compact: %v", every, got)
+		}
+	}
+	// 非排序字段不记录 doc values，从文档中取值
+	s := scoreSearcher()
+	s.SetSortField("year")
+	s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, s.docCurId},
+		&IntField{BaseField{true, "year"}, 1930},
+		&StrSliceField{BaseField{true, "term"}, []string{"历史"}},
+	}})
+	if dv := s.cur.docValues; len(dv) != 1 || dv["year"].value(4) != 1930 {
+		t.Errorf("doc values: %v", dv)
+	}
+	// 缺少值的文档排在最后
+	if got := ids(s.FindSorted(termQuery("历史"), SortField{"name", true})); !equalIds(got, []int{0, 1, 3, 4}) {
+		t.Errorf("missing name: %v", got)
+	}
+	if got := ids(s.FindSorted(termQuery("历史"), SortField{"year", false})); !equalIds(got, []int{4, 0, 1, 3}) {
+		t.Errorf("year: %v", got)
+	}
+}
@@ -2,25 +2,47 @@ package search
 
 import (
 	"strconv"
+	"sync"
 )
 
 type Boolean int
 
 const (
-	MUST   Boolean = iota
-	SHOULD Boolean = iota
+	MUST     Boolean = iota
+	SHOULD   Boolean = iota
+	MUST_NOT Boolean = iota
 )
 
-var (
-	docCurId  = 0
-	termCurId = 0
-	docs      = map[int]*Document{}
-	lexicon   = map[Term]int{}
-	indexes = map[int]*Index{}
-)
+// positionGap 为同名字段相邻两个值之间的位置间隔，大于常用的邻近距离
+const positionGap = 100
 
+// Searcher 可被多个 goroutine 同时使用，Add 持有写锁，查询持有读锁。
+// 索引分为多个段，新文档写入 cur，封存后加入 segments
 type Searcher struct {
-	index map[int][]int
+	mu       sync.RWMutex
+	index    map[int][]int
+	docCurId int
+	docs     map[int]*Document
+	segments []*segment
+	cur      *segment
+	// merging 为 true 时有后台合并正在进行，结束时通知 mergeCond；
+	// compacting 为 true 时后台合并还要逐个清除已封存段中的已删除文档
+	merging    bool
+	compacting bool
+	mergeCond  *sync.Cond
+	// norms 为各字段在每个文档中的词项数，下标为 docId
+	norms map[string][]int
+	stats map[string]*fieldStats
+	bm25  BM25
+	// analyzed 为分词字段，analyzers 为通过 SetAnalyzer 指定的 Analyzer
+	analyzed  map[string]bool
+	analyzers map[string]*Analyzer
+	// filterFields 为过滤字段，各段中另外以 bitmap 保存
+	filterFields map[string]bool
+	// sortFields 为排序字段，各段中另外按列保存 doc values
+	sortFields map[string]bool
+	// deleted 为已删除但仍在倒排表中的文档
+	deleted *bitmap
 }
 
 type Field interface {
@@ -69,15 +91,29 @@ func (f *StrSliceField) Terms() []Term {
 	return res
 }
 
+func (f *StrSliceField) analyze(a *Analyzer) []Term {
+	res := []Term{}
+	for _, v := range f.Value {
+		for _, t := range a.Analyze(v) {
+			res = append(res, Term{f.Name, t.Text})
+		}
+	}
+	return res
+}
+
 func (f *StrSliceField) GetValue() interface{} {
 	return f.Value
 }
 
+// SearchResult 中 Scores 与 Docs 一一对应，Facets 为 FindFacets 统计的各字段取值
 type SearchResult struct {
-	Docs []*Document
-	Total int
+	Docs   []*Document
+	Scores []float64
+	Total  int
+	Facets map[string][]*FacetCount
 }
 
+// Document 中可以有多个同名字段，各自作为该字段的一个值，短语和邻近查询不跨值匹配
 type Document struct {
 	Fields []Field
 }
@@ -87,38 +123,9 @@ type Term struct {
 	Value string
 }
 
-type Index struct{
-	Item *IndexItem
-	Size int
-}
-
-type IndexItem struct {
-	docId int
-	next  *IndexItem
-}
-
-func (i *IndexItem) add(item *IndexItem) *IndexItem {
-	if i.docId > item.docId {
-		item.next = i
-		i.next = nil
-		return item
-	} else if i.docId < item.docId {
-		if i.next != nil {
-			i.next = i.next.add(item)
-		} else {
-			i.next = item
-		}
-	}
-	return i
-}
-
-func (i *IndexItem) clone() *IndexItem {
-	return &IndexItem{i.docId, i.next}
-}
-
 type Query interface {
 	Match(t *Term) bool
-	Search() *Index
+	Search(s *Searcher) *Index
 }
 
 type TermQuery struct {
@@ -129,20 +136,29 @@ func (q *TermQuery) Match(t *Term) bool {
 	return &t == &q.T
 }
 
-func (q *TermQuery) search() *Index {
-	tid, e := lexicon[*q.T]
-	if !e {
-		return nil
-	}
-	ii, e := indexes[tid]
-	if !e {
-		return nil
+func (q *TermQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+// iterator 对分词字段先分词，要求文档中依次相邻出现所有词
+func (q *TermQuery) iterator(s *Searcher, seg *segment) docIterator {
+	if s.analyzer(q.T.Field) == nil {
+		return s.termIterator(seg, q.T)
 	}
-	return ii
+	return (&PhraseQuery{q.T.Field, []string{q.T.Value}}).iterator(s, seg)
 }
 
-func (q *TermQuery) Search() *Index {
-	return q.search()
+// termIterator 遍历段中包含词项的文档，相关度按所有段的文档数计算
+func (s *Searcher) termIterator(seg *segment, t *Term) docIterator {
+	tid, ok := seg.lexicon[*t]
+	if !ok {
+		return &emptyIterator{-1}
+	}
+	it := newListIterator(seg.indexes[tid])
+	if l, ok := it.(*listIterator); ok {
+		l.scorer = s.termScorer(t.Field, s.docFreq(t))
+	}
+	return it
 }
 
 type TermPageQuery struct {
@@ -151,168 +167,68 @@ type TermPageQuery struct {
 	Limit int
 }
 
-func (q *TermPageQuery) Search() *Index {
-	ii := q.search()
-	res := &Index{Size:ii.Size}
-	cur := ii.Item
-	for i,l:=0,0;;i++{
-		if i < q.Start{
-			cur = cur.next
-			if cur == nil{
-				break
-			}
-		}else {
-			if i == q.Start{
-				cur = cur.clone()
-				res.Item = cur
-				l++
-			}
-			if cur.next == nil{
-				break
-			}
-			if l >=	q.Limit{
-				cur.next = nil
-				break
-			}
-			cur.next = cur.next.clone()
-			cur = cur.next
-			l++
-		}
-	}
-	return res
+func (q *TermPageQuery) Search(s *Searcher) *Index {
+	return page(q.TermQuery.Search(s), q.Start, q.Limit)
 }
 
-type BooleanQuery struct {
-	Q1  Query
-	Q2  Query
-	Rel Boolean
+// PageQuery 对任意查询的结果分页
+type PageQuery struct {
+	Q     Query
 	Start int
 	Limit int
 }
 
-func (q *BooleanQuery) Match(t *Term) bool {
-	res := false
-	switch q.Rel {
-	case MUST:
-		res = q.Q1.Match(t) && q.Q2.Match(t)
-	case SHOULD:
-		res = q.Q1.Match(t) || q.Q2.Match(t)
-	}
-	return res
+func (q *PageQuery) Match(t *Term) bool {
+	return q.Q.Match(t)
 }
 
-func mergeShould(i1 *Index, i2 *Index, start int, limit int) (res *Index) {
-	total := i1.Size + i2.Size
-	ci1, ci2 := i1.Item, i2.Item
-	var cur *IndexItem
-	res = &Index{Size:total}
-	i := 0
-	if i1.Item.docId <= i2.Item.docId {
-		cur = i1.Item.clone()
-	} else {
-		cur = i2.Item.clone()
-	}
-	cur.next = nil
-	for {
-		if start == i{
-			res.Item = cur
-		}
-		if ci1 == nil {
-			if ci2 == nil {
-				break
-			}
-			cur.next = ci2.clone()
-			i = i + 1
-			break
-		}
-		if ci2 == nil {
-			cur.next = ci1.clone()
-			i = i + 1
-			break
-		}
-		if ci1.docId == ci2.docId {
-			cur.next = ci1.clone()
-			cur = cur.next
-			ci1 = ci1.next
-			ci2 = ci2.next
-		} else if ci1.docId > ci2.docId {
-			cur.next = ci2.clone()
-			cur = cur.next
-			ci2 = ci2.next
-		} else {
-			cur.next = ci1.clone()
-			cur = cur.next
-			ci1 = ci1.next
-		}
-		i = i + 1
-		if(i >= limit){
-			break;
-		}
-	}
-	return res
+func (q *PageQuery) Search(s *Searcher) *Index {
+	return page(q.Q.Search(s), q.Start, q.Limit)
 }
 
-func mergeMust(i1 *Index, i2 *Index, start int, limit int) (res *Index) {
-	res = &Index{Size:0}
-	var cur *IndexItem
-	ci1, ci2 := i1.Item, i2.Item
-	var last *IndexItem
-	i := 0
-	for {
-		if ci1.docId == ci2.docId {
-			if res.Size < start{
-				cur = ci1
-			}else if res.Size == start{
-				res.Item = ci1.clone()
-				cur = res.Item
-				i++
-			}else{
-				cur.next = ci1.clone()
-				cur = cur.next
-				i++
-			}
-			if i <= limit{
-				last = cur
-			}
-			ci1 = ci1.next
-			ci2 = ci2.next
-			res.Size = res.Size + 1
-		} else if ci1.docId < ci2.docId {
-			ci1 = ci1.next
-		} else if ci1.docId > ci2.docId {
-			ci2 = ci2.next
-		}
-		if ci1 == nil || ci2 == nil {
+// page 复制 [start, start+limit) 范围内的结果，Size 仍为总数
+func page(i *Index, start int, limit int) *Index {
+	if i == nil || (start == 0 && limit == 0) {
+		return i
+	}
+	res := &Index{}
+	it := newListIterator(i)
+	n := 0
+	for d := it.nextDoc(); d != noMoreDocs; d = it.nextDoc() {
+		if limit > 0 && n >= start+limit {
 			break
 		}
+		if n >= start {
+			res.add(d, 1, nil)
+		}
+		n++
 	}
-	if last != nil{
-		last.next = nil
-	}
+	res.Size = i.Size
 	return res
 }
 
-func (q *BooleanQuery) Search() *Index {
-	ii1 := q.Q1.Search()
-	ii2 := q.Q2.Search()
-	if ii1 == nil {
-		return ii2
-	}
-	if ii2 == nil {
-		return ii1
-	}
-	if q.Rel == MUST {
-		return mergeMust(ii1, ii2, q.Start, q.Limit)
-	}
-	return mergeShould(ii1, ii2, q.Start, q.Limit)
-}
-
 func NewSearcher() *Searcher {
-	m := map[int][]int{}
-	return &Searcher{m}
+	s := &Searcher{
+		index: map[int][]int{},
+		docs:  map[int]*Document{},
+		norms: map[string][]int{},
+		stats: map[string]*fieldStats{},
+		bm25:  DefaultBM25,
+
+		analyzed:  map[string]bool{},
+		analyzers: map[string]*Analyzer{},
+
+		filterFields: map[string]bool{},
+		sortFields:   map[string]bool{},
+		deleted:      &bitmap{},
+	}
+	s.mergeCond = sync.NewCond(&s.mu)
+	return s
 }
 
 func (s *Searcher) Put(term int, doc int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	v, exists := s.index[term]
 	if !exists {
 		v = []int{doc}
@@ -332,53 +248,132 @@ func (s *Searcher) Put(term int, doc int) {
 }
 
 func (s *Searcher) Get(term int) ([]int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	v, exists := s.index[term]
 	return v, exists
 }
 
-func (s *Searcher) Add(doc *Document) {
-	id := docCurId
-	docs[id] = doc
-	docCurId++
+// Add 添加文档，返回文档的 id。文档写入当前段，达到 flushDocs 个文档时封存该段
+func (s *Searcher) Add(doc *Document) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(doc)
+}
+
+func (s *Searcher) add(doc *Document) int {
+	id := s.docCurId
+	s.docs[id] = doc
+	s.docCurId++
+	if s.cur == nil {
+		s.cur = newSegment(id)
+	}
+	seg := s.cur
+	seg.max = id + 1
+	seg.count++
+	seg.filters.clear()
+	seg.addDocValues(id, doc, s.sortFields)
+	// 同名字段的多个值依次排列，值之间的位置相差 positionGap，短语和邻近查询不会跨值匹配
+	names := []string{}
+	fieldTerms := map[string][]Term{}
+	fieldPos := map[string][]int{}
+	numeric := map[Term]int{}
 	for _, f := range doc.Fields {
-		ts := f.Terms()
-		if ts != nil {
-			for _, t := range ts {
-				ii := &IndexItem{docId: id}
-				tid, e := lexicon[t]
-				if !e {
-					tid = termCurId
-					termCurId++
-					lexicon[t] = tid
-				}
-				idx, ex := indexes[tid]
-				if !ex {
-					idx = &Index{ii, 1}
-					indexes[tid] = idx
-				} else {
-					idx.Item.add(ii);
-					idx.Size = idx.Size + 1
-				}
+		if !f.IsIndexed() {
+			continue
+		}
+		name := f.GetName()
+		if _, ok := f.(*TextField); ok {
+			s.analyzed[name] = true
+		}
+		var ts []Term
+		if af, ok := f.(analyzable); ok && s.analyzer(name) != nil {
+			ts = af.analyze(s.analyzer(name))
+		} else {
+			ts = f.Terms()
+		}
+		if len(ts) == 0 {
+			continue
+		}
+		off := 0
+		if ps, ok := fieldPos[name]; ok {
+			off = ps[len(ps)-1] + positionGap
+		} else {
+			names = append(names, name)
+		}
+		for i, t := range ts {
+			fieldTerms[name] = append(fieldTerms[name], t)
+			fieldPos[name] = append(fieldPos[name], off+i)
+		}
+		if nf, ok := f.(*IntField); ok {
+			numeric[ts[0]] = nf.Value
+		}
+	}
+	for _, name := range names {
+		ts := fieldTerms[name]
+		s.addNorm(name, id, len(ts))
+		positions := map[Term][]int{}
+		for i, t := range ts {
+			positions[t] = append(positions[t], fieldPos[name][i])
+		}
+		for _, t := range ts {
+			pos, ok := positions[t]
+			if !ok {
+				continue
+			}
+			delete(positions, t)
+			tid, isNew := seg.term(t)
+			if v, ok := numeric[t]; ok && isNew {
+				seg.addNumeric(name, v, tid)
+			}
+			seg.indexes[tid].add(id, len(pos), pos)
+			if s.filterFields[t.Field] {
+				seg.addBitmap(tid, id)
 			}
 		}
 	}
+	if seg.count >= flushDocs {
+		s.flush()
+	}
+	return id
 }
 
+// Find 返回按相关度降序排列的结果，相关度相同时按 docId 排列
 func (s *Searcher) Find(q Query) *SearchResult {
-	res := &SearchResult{[]*Document{}, 0}
-	i := q.Search()
-	if i != nil {
-		res.Total = i.Size
-		ii := i.Item
-		if i.Item != nil{
-			for {
-				res.Docs = append(res.Docs, docs[ii.docId])
-				if ii.next == nil {
-					break
-				}
-				ii = ii.next
-			}
-		}
+	return s.FindSorted(q)
+}
+
+// FindSorted 按 sort 指定的顺序返回结果，未指定时按相关度排列。
+// PageQuery、TermPageQuery 及 BooleanQuery 的分页在排序后进行
+func (s *Searcher) FindSorted(q Query, sort ...SortField) *SearchResult {
+	return s.FindFacets(q, nil, sort...)
+}
+
+// FindFacets 与 FindSorted 相同，同时统计全部结果(不只是当前页)中 facets 指定字段的取值
+func (s *Searcher) FindFacets(q Query, facets []*FacetRequest, sort ...SortField) *SearchResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, start, limit := unwrapPage(q)
+	// 分面统计需要全部结果，否则只保留分页范围内的结果
+	n := 0
+	if limit > 0 && len(facets) == 0 {
+		n = start + limit
+	}
+	hits, total := s.collect(s.iterator(q), sort, n)
+	res := &SearchResult{Docs: []*Document{}, Scores: []float64{}, Total: total}
+	if len(facets) > 0 {
+		res.Facets = s.facets(hits, facets)
+	}
+	if start > len(hits) {
+		start = len(hits)
+	}
+	end := len(hits)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	for _, h := range hits[start:end] {
+		res.Docs = append(res.Docs, s.docs[h.doc])
+		res.Scores = append(res.Scores, h.score)
 	}
 	return res
 }
@@ -47,16 +47,16 @@ func TestSearch(t *testing.T) {
 	q1 := &TermQuery{&Term{termsName, "中国"}}
 	q2 := &TermQuery{&Term{termsName, "北京"}}
 	q21 := &TermQuery{&Term{termsName, "上海"}}
-	q3 := &BooleanQuery{q1, q21, SHOULD}
-	q4 := &BooleanQuery{q1, q2, MUST}
+	q3 := NewBooleanQuery(&Clause{q1, SHOULD}, &Clause{q21, SHOULD})
+	q4 := NewBooleanQuery(&Clause{q1, MUST}, &Clause{q2, MUST})
 	fmt.Println("search:中国")
-	printDocs(searcher.Find(q1))
+	printDocs(searcher.Find(q1).Docs)
 	fmt.Println("search:北京")
-	printDocs(searcher.Find(q2))
+	printDocs(searcher.Find(q2).Docs)
 	fmt.Println("search:中国 || 上海")
-	printDocs(searcher.Find(q3))
+	printDocs(searcher.Find(q3).Docs)
 	fmt.Println("search:中国 && 北京")
-	printDocs(searcher.Find(q4))
+	printDocs(searcher.Find(q4).Docs)
 }
 
 func printDocs(docs []*Document) {
@@ -71,3 +71,21 @@ func printDoc(doc *Document) {
 	}
 	fmt.Println()
 }
+
+func TestIsolation(t *testing.T) {
+	s1 := NewSearcher()
+	s2 := NewSearcher()
+	s1.Add(&Document{[]Field{&StrSliceField{BaseField{true, "term"}, []string{"北京"}}}})
+	s2.Add(&Document{[]Field{&StrSliceField{BaseField{true, "term"}, []string{"上海"}}}})
+	s2.Add(&Document{[]Field{&StrSliceField{BaseField{true, "term"}, []string{"北京"}}}})
+	q := &TermQuery{&Term{"term", "北京"}}
+	if r := s1.Find(q); r.Total != 1 || r.Docs[0] != s1.docs[0] {
+		t.Errorf("s1 total %d", r.Total)
+	}
+	if r := s2.Find(q); r.Total != 1 || r.Docs[0] != s2.docs[1] {
+		t.Errorf("s2 total %d", r.Total)
+	}
+	if r := s1.Find(&TermQuery{&Term{"term", "上海"}}); r.Total != 0 {
+		t.Errorf("s1 found terms of s2")
+	}
+}
@@ -0,0 +1,402 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// 正在写入的段达到 flushDocs 个文档时自动封存
+const flushDocs = 10000
+
+// 同一级别的相邻段达到 mergeFactor 个时在后台合并为一个段
+const mergeFactor = 10
+
+// 级别相差不超过 levelSpan 的段视为同一级别
+const levelSpan = 0.75
+
+// segment 为一批文档的索引，docId 都在 [base, max) 内，count 为其中未清除的文档数。
+// 各段的 docId 范围依次递增且不重叠。除 Searcher 正在写入的段外，段生成后不再修改，
+// 删除的文档由 Searcher.deleted 标记，合并或压缩时生成新的段
+type segment struct {
+	base      int
+	max       int
+	count     int
+	termCurId int
+	lexicon   map[Term]int
+	indexes   map[int]*Index
+	dicts     map[string]*termDict
+	dictMu    *sync.Mutex
+	numeric   map[string]*numericIndex
+	// docValues 为各排序字段按列存储的值
+	docValues map[string]*docValues
+	// bitmaps 为过滤字段中各词项的文档，filters 缓存过滤条件在本段中的结果
+	bitmaps map[int]*bitmap
+	filters *filterCache
+}
+
+func newSegment(base int) *segment {
+	return &segment{
+		base:      base,
+		max:       base,
+		lexicon:   map[Term]int{},
+		indexes:   map[int]*Index{},
+		dicts:     map[string]*termDict{},
+		dictMu:    &sync.Mutex{},
+		numeric:   map[string]*numericIndex{},
+		docValues: map[string]*docValues{},
+		bitmaps:   map[int]*bitmap{},
+		filters:   &filterCache{},
+	}
+}
+
+// term 返回词项 id，词项不存在时添加，isNew 为 true
+func (seg *segment) term(t Term) (tid int, isNew bool) {
+	if tid, ok := seg.lexicon[t]; ok {
+		return tid, false
+	}
+	tid = seg.termCurId
+	seg.termCurId++
+	seg.lexicon[t] = tid
+	seg.indexes[tid] = &Index{}
+	seg.addTerm(t, tid)
+	return tid, true
+}
+
+func (seg *segment) addBitmap(tid int, doc int) {
+	b, ok := seg.bitmaps[tid]
+	if !ok {
+		b = &bitmap{}
+		seg.bitmaps[tid] = b
+	}
+	b.add(doc)
+}
+
+// removeEmpty 删除没有文档的词项
+func (seg *segment) removeEmpty() {
+	removed := map[int]bool{}
+	for t, tid := range seg.lexicon {
+		if seg.indexes[tid].Size == 0 {
+			delete(seg.lexicon, t)
+			delete(seg.indexes, tid)
+			delete(seg.bitmaps, tid)
+			removed[tid] = true
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	seg.buildDicts()
+	for _, ni := range seg.numeric {
+		values, terms := ni.Values[:0], ni.Terms[:0]
+		for i, tid := range ni.Terms {
+			if !removed[tid] {
+				values, terms = append(values, ni.Values[i]), append(terms, tid)
+			}
+		}
+		ni.Values, ni.Terms, ni.sorted = values, terms, len(values)
+	}
+}
+
+// mergeSegments 将 docId 范围相邻的多个段合并为一个新段，并清除 deleted 中的文档，
+// 返回新段及被清除的文档
+func mergeSegments(segs []*segment, deleted *bitmap, filterFields map[string]bool) (*segment, *bitmap) {
+	res := newSegment(segs[0].base)
+	res.max = segs[len(segs)-1].max
+	purged := &bitmap{}
+	it := newBitmapIterator(deleted)
+	for d := it.advance(res.base); d < res.max; d = it.nextDoc() {
+		purged.add(d)
+	}
+	for _, seg := range segs {
+		res.count += seg.count
+		for field, dv := range seg.docValues {
+			for i := range dv.Exists {
+				if d := seg.base + i; !purged.contains(d) {
+					res.setDocValue(field, d, dv.value(i))
+				}
+			}
+		}
+		values := map[int]int{}
+		for _, ni := range seg.numeric {
+			for i, tid := range ni.Terms {
+				values[tid] = ni.Values[i]
+			}
+		}
+		for t, tid := range seg.lexicon {
+			ntid, isNew := res.term(t)
+			if v, ok := values[tid]; ok && isNew {
+				res.addNumeric(t.Field, v, ntid)
+			}
+			idx := res.indexes[ntid]
+			l, ok := newListIterator(seg.indexes[tid]).(*listIterator)
+			if !ok {
+				continue
+			}
+			for d := l.nextDoc(); d != noMoreDocs; d = l.nextDoc() {
+				if purged.contains(d) {
+					continue
+				}
+				idx.add(d, l.freq, l.positions())
+				if filterFields[t.Field] {
+					res.addBitmap(ntid, d)
+				}
+			}
+		}
+	}
+	res.count -= purged.cardinality()
+	res.sortDicts()
+	res.removeEmpty()
+	return res, purged
+}
+
+// searchSegments 返回所有可查询的段，包括正在写入的段
+func (s *Searcher) searchSegments() []*segment {
+	if s.cur == nil {
+		return s.segments
+	}
+	return append(s.segments[:len(s.segments):len(s.segments)], s.cur)
+}
+
+// iterator 依次遍历各段中匹配查询的文档，不包含已删除的文档
+func (s *Searcher) iterator(q Query) docIterator {
+	if _, ok := q.(iterable); !ok {
+		return s.live(newListIterator(q.Search(s)))
+	}
+	c := &chainIterator{doc: -1}
+	for _, seg := range s.searchSegments() {
+		c.its = append(c.its, iteratorOf(s, seg, q))
+		c.maxes = append(c.maxes, seg.max)
+	}
+	return s.live(c)
+}
+
+// docFreq 为所有段中包含词项的文档数，包括已删除但未清除的文档
+func (s *Searcher) docFreq(t *Term) int {
+	n := 0
+	for _, seg := range s.searchSegments() {
+		if tid, ok := seg.lexicon[*t]; ok {
+			n += seg.indexes[tid].Size
+		}
+	}
+	return n
+}
+
+// Flush 封存正在写入的段，之后添加的文档写入新的段。封存后可能在后台合并
+func (s *Searcher) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+func (s *Searcher) flush() {
+	if s.cur == nil || s.cur.count == 0 {
+		return
+	}
+	s.cur.sortDicts()
+	s.segments = append(s.segments, s.cur)
+	s.cur = nil
+	s.maybeCompact()
+	s.maybeMerge()
+}
+
+// level 为段的级别，即文档数以 mergeFactor 为底的对数
+func level(n int) float64 {
+	if n < 1 {
+		n = 1
+	}
+	return math.Log(float64(n)) / math.Log(mergeFactor)
+}
+
+// mergeCandidates 按对数合并策略找出需要合并的段：从最早的段开始，取之后各段的最高级别，
+// 级别与之相差不超过 levelSpan 的最后一个段及之前的段每 mergeFactor 个相邻的段合并为一个，
+// 其间级别较低的段(如合并时封存的段、清除文档后变小的段)一起合并；
+// 剩余不足 mergeFactor 个时从下一个段开始按同样方法处理
+func (s *Searcher) mergeCandidates() []*segment {
+	segs := s.segments
+	for start := 0; start < len(segs); {
+		max := 0.0
+		for _, seg := range segs[start:] {
+			if l := level(seg.count); l > max {
+				max = l
+			}
+		}
+		upto := len(segs) - 1
+		for level(segs[upto].count) < max-levelSpan {
+			upto--
+		}
+		if start+mergeFactor <= upto+1 {
+			return append([]*segment{}, segs[start:start+mergeFactor]...)
+		}
+		start = upto + 1
+	}
+	return nil
+}
+
+// maybeMerge 在有可合并的段或需要压缩且没有正在进行的合并时启动后台合并，须持有写锁
+func (s *Searcher) maybeMerge() {
+	if s.merging || !s.compacting && s.mergeCandidates() == nil {
+		return
+	}
+	s.merging = true
+	go s.mergeLoop()
+}
+
+// mergeLoop 合并时不持有锁，已封存的段不会被修改；
+// 合并期间段被压缩或替换时放弃本次结果。没有可合并的段时逐个压缩包含已删除文档的段
+func (s *Searcher) mergeLoop() {
+	for {
+		s.mu.Lock()
+		segs := s.mergeCandidates()
+		if segs == nil && s.compacting {
+			if seg := s.compactCandidate(); seg != nil {
+				segs = []*segment{seg}
+			} else {
+				s.compacting = false
+			}
+		}
+		if segs == nil {
+			s.merging = false
+			s.mergeCond.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+		deleted := s.deleted.or(&bitmap{})
+		filterFields := map[string]bool{}
+		for f := range s.filterFields {
+			filterFields[f] = true
+		}
+		s.mu.Unlock()
+
+		merged, purged := mergeSegments(segs, deleted, filterFields)
+
+		s.mu.Lock()
+		s.replaceSegments(segs, merged, purged)
+		s.mu.Unlock()
+	}
+}
+
+// replaceSegments 将连续的 segs 替换为 merged，segs 已不在 s.segments 中时不替换
+func (s *Searcher) replaceSegments(segs []*segment, merged *segment, purged *bitmap) bool {
+	i := sort.Search(len(s.segments), func(j int) bool {
+		return s.segments[j].base >= segs[0].base
+	})
+	if i+len(segs) > len(s.segments) {
+		return false
+	}
+	for j, seg := range segs {
+		if s.segments[i+j] != seg {
+			return false
+		}
+	}
+	res := append([]*segment{}, s.segments[:i]...)
+	if merged.count > 0 {
+		res = append(res, merged)
+	}
+	s.segments = append(res, s.segments[i+len(segs):]...)
+	s.deleted = s.deleted.andNot(purged)
+	return true
+}
+
+// WaitMerges 等待正在进行的后台合并完成
+func (s *Searcher) WaitMerges() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.merging {
+		s.mergeCond.Wait()
+	}
+}
+
+// chainIterator 依次遍历 docId 范围递增且不重叠的多个迭代器，maxes 为各范围的上界
+type chainIterator struct {
+	its   []docIterator
+	maxes []int
+	i     int
+	doc   int
+}
+
+func (c *chainIterator) docID() int {
+	return c.doc
+}
+
+func (c *chainIterator) nextDoc() int {
+	for ; c.i < len(c.its); c.i++ {
+		if d := c.its[c.i].nextDoc(); d != noMoreDocs {
+			c.doc = d
+			return d
+		}
+	}
+	c.doc = noMoreDocs
+	return c.doc
+}
+
+func (c *chainIterator) advance(target int) int {
+	for ; c.i < len(c.its); c.i++ {
+		if target >= c.maxes[c.i] {
+			continue
+		}
+		if d := c.its[c.i].advance(target); d != noMoreDocs {
+			c.doc = d
+			return d
+		}
+	}
+	c.doc = noMoreDocs
+	return c.doc
+}
+
+func (c *chainIterator) cost() int {
+	n := 0
+	for _, it := range c.its {
+		n += it.cost()
+	}
+	return n
+}
+
+func (c *chainIterator) score() float64 {
+	if c.i >= len(c.its) {
+		return 0
+	}
+	return c.its[c.i].score()
+}
+
+// clipIterator 只返回 [min, max) 内的文档
+type clipIterator struct {
+	it  docIterator
+	min int
+	max int
+	doc int
+}
+
+func (c *clipIterator) docID() int {
+	return c.doc
+}
+
+func (c *clipIterator) nextDoc() int {
+	if c.doc < 0 {
+		return c.advance(c.min)
+	}
+	return c.check(c.it.nextDoc())
+}
+
+func (c *clipIterator) advance(target int) int {
+	if target < c.min {
+		target = c.min
+	}
+	return c.check(c.it.advance(target))
+}
+
+func (c *clipIterator) check(d int) int {
+	if d >= c.max {
+		d = noMoreDocs
+	}
+	c.doc = d
+	return d
+}
+
+func (c *clipIterator) cost() int {
+	return c.it.cost()
+}
+
+func (c *clipIterator) score() float64 {
+	return c.it.score()
+}
@@ -0,0 +1,226 @@
+package search
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type segDoc struct {
+	year  int
+	name  string
+	terms []string
+}
+
+var segDocs = []segDoc{
+	{1949, "北京历史地理", []string{"北京", "历史"}},
+	{1950, "上海史话", []string{"上海", "历史"}},
+	{1950, "北京风物", []string{"北京", "地理"}},
+	{1955, "中国近代史", []string{"中国", "近代史"}},
+	{1960, "北京近代史", []string{"北京", "近代史", "历史"}},
+	{1960, "上海地理", []string{"上海", "地理"}},
+	{1970, "北京", []string{"北京"}},
+	{1975, "中国近代史纲", []string{"中国", "近代史"}},
+}
+
+// segSearcher 添加 segDocs，每 every 个文档封存一个段，every 为 0 时不封存
+func segSearcher(every int) *Searcher {
+	s := NewSearcher()
+	s.SetFilterField("year")
+	for i, d := range segDocs {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, i},
+			&IntField{BaseField{true, "year"}, d.year},
+			&StrSliceField{BaseField{true, "term"}, d.terms},
+			&TextField{BaseField{true, "name"}, d.name},
+		}})
+		if every > 0 && (i+1)%every == 0 {
+			s.Flush()
+		}
+	}
+	return s
+}
+
+func segQueries() []Query {
+	return []Query{
+		termQuery("北京"),
+		NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("历史"), SHOULD}),
+		NewBooleanQuery(&Clause{termQuery("历史"), MUST}, &Clause{termQuery("上海"), MUST_NOT}),
+		&TermQuery{&Term{"name", "近代史"}},
+		&SpanNearQuery{"name", []string{"北京", "史"}, 3, true},
+		&PrefixQuery{"term", "近"},
+		&FuzzyQuery{Field: "term", Value: "近代使"},
+		&RangeQuery{Field: "year", Min: 1950, Max: 1960},
+		&FilteredQuery{termQuery("北京"), &RangeFilter{&RangeQuery{Field: "year", Min: 1950, NoMax: true}}},
+		&FilteredQuery{nil, &BooleanFilter{Should: []Filter{yearFilter("1950"), yearFilter("1975")}}},
+		&PageQuery{termQuery("历史"), 1, 2},
+		&PageQuery{&PageQuery{termQuery("北京"), 0, 3}, 0, 0},
+	}
+}
+
+// sameResults 检查两个 Searcher 对所有查询返回相同的结果及得分
+func sameResults(t *testing.T, name string, a *Searcher, b *Searcher) {
+	for i, q := range segQueries() {
+		ra, rb := a.Find(q), b.Find(q)
+		if !equalIds(ids(ra), ids(rb)) || ra.Total != rb.Total {
+			t.Errorf("%s query %d: %v total %d, want %v total %d", name, i, ids(ra), ra.Total, ids(rb), rb.Total)
+			continue
+		}
+		for j := range ra.Scores {
+			if d := ra.Scores[j] - rb.Scores[j]; d > 1e-9 || d < -1e-9 {
+				t.Errorf("%s query %d: scores %v, want %v", name, i, ra.Scores, rb.Scores)
+				break
+			}
+		}
+	}
+}
+
+func TestSegmentSearch(t *testing.T) {
+	single := segSearcher(0)
+	for _, every := range []int{1, 3, 5} {
+		s := segSearcher(every)
+		if n := len(s.segments); n != len(segDocs)/every {
+			t.Errorf("every %d: %d segments", every, n)
+		}
+		sameResults(t, "every "+strconv.Itoa(every), s, single)
+		sameResults(t, "loaded "+strconv.Itoa(every), saveLoad(t, s), single)
+	}
+	r := segSearcher(3).FindFacets(termQuery("北京"), []*FacetRequest{{"year", 10}})
+	if got := facetString(r.Facets["year"]); got != "1949:1 1950:1 1960:1 1970:1 " {
+		t.Errorf("facets: %s", got)
+	}
+}
+
+func TestSegmentMerge(t *testing.T) {
+	s := NewSearcher()
+	s.SetFilterField("year")
+	n := mergeFactor*2 + 3
+	for i := 0; i < n; i++ {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, i},
+			&IntField{BaseField{true, "year"}, 1950 + i%3},
+			&StrSliceField{BaseField{true, "term"}, []string{"北京", "t" + strconv.Itoa(i%4)}},
+		}})
+		s.Flush()
+		s.WaitMerges()
+		if i == mergeFactor+5 {
+			s.Delete(idTerm(mergeFactor + 2))
+		}
+	}
+	// 前 mergeFactor*2 个段合并为两个段，合并时清除已删除的文档
+	if len(s.segments) != 5 {
+		t.Fatalf("%d segments after merge, want 5", len(s.segments))
+	}
+	if a, b := s.segments[0].count, s.segments[1].count; a != mergeFactor || b != mergeFactor-1 {
+		t.Errorf("merged segments have %d and %d docs", a, b)
+	}
+	if s.deleted.cardinality() != 0 {
+		t.Errorf("deleted doc not purged")
+	}
+	r := s.Find(termQuery("北京"))
+	if r.Total != n-1 {
+		t.Errorf("北京: total %d, want %d", r.Total, n-1)
+	}
+	want := []int{}
+	for i := 0; i < n; i++ {
+		if i%4 == 1 && 1950+i%3 == 1951 {
+			want = append(want, i)
+		}
+	}
+	q := &FilteredQuery{termQuery("t1"), yearFilter("1951")}
+	if got := sortedIds(s.Find(q)); !equalIds(got, want) {
+		t.Errorf("t1 in 1951: %v, want %v", got, want)
+	}
+}
+
+func TestSegmentIncremental(t *testing.T) {
+	s := saveLoad(t, segSearcher(0))
+	// 加载后追加一批文档作为新的段
+	id := s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, len(segDocs)},
+		&IntField{BaseField{true, "year"}, 1980},
+		&StrSliceField{BaseField{true, "term"}, []string{"北京", "历史"}},
+	}})
+	s.Flush()
+	if id != len(segDocs) || len(s.segments) != 2 {
+		t.Fatalf("id %d, %d segments", id, len(s.segments))
+	}
+	if got := sortedIds(s.Find(termQuery("北京"))); !equalIds(got, []int{0, 2, 4, 6, 8}) {
+		t.Errorf("北京: %v", got)
+	}
+	if got := sortedIds(s.Find(&FilteredQuery{nil, &RangeFilter{&RangeQuery{Field: "year", Min: 1975, NoMax: true}}})); !equalIds(got, []int{7, 8}) {
+		t.Errorf("year >= 1975: %v", got)
+	}
+}
+
+// 后台合并期间继续封存的段、文档数略少于同级别的段(如清除了删除的文档)与相邻的段一起合并，段数保持有界
+func TestSegmentMergeBounded(t *testing.T) {
+	s := NewSearcher()
+	for i := 0; i < mergeFactor*mergeFactor*2; i++ {
+		// 交替封存 mergeFactor-1 和 mergeFactor 个文档的段，不等待合并完成
+		for j := 0; j < mergeFactor-i%2; j++ {
+			s.Add(&Document{[]Field{
+				&IntField{BaseField{true, "id"}, s.docCurId},
+				&StrSliceField{BaseField{true, "term"}, []string{"北京"}},
+			}})
+		}
+		if i%7 == 0 {
+			s.Delete(idTerm(s.docCurId / 2))
+		}
+		s.Flush()
+	}
+	s.WaitMerges()
+	if s.mergeCandidates() != nil {
+		t.Errorf("candidates left after merges")
+	}
+	// 约 2000 个文档，每个级别最多 mergeFactor-1 个段
+	if max := (mergeFactor - 1) * 4; len(s.segments) > max {
+		t.Errorf("%d segments, want at most %d", len(s.segments), max)
+	}
+	if r := s.Find(termQuery("北京")); r.Total != len(s.docs) {
+		t.Errorf("total %d, want %d", r.Total, len(s.docs))
+	}
+}
+
+// 使用 go test -race 运行以检查后台合并时的数据竞争
+func TestSegmentConcurrent(t *testing.T) {
+	s := NewSearcher()
+	n := mergeFactor * mergeFactor
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			s.Add(&Document{[]Field{
+				&IntField{BaseField{true, "id"}, i},
+				&IntField{BaseField{true, "year"}, 1950 + i%10},
+				&StrSliceField{BaseField{true, "term"}, []string{"北京", "t" + strconv.Itoa(i%7)}},
+			}})
+			s.Flush()
+			if i%9 == 0 {
+				s.Delete(idTerm(i / 2))
+			}
+		}
+	}()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				r := s.Find(NewBooleanQuery(&Clause{termQuery("北京"), MUST}, &Clause{termQuery("t" + strconv.Itoa(g)), MUST}))
+				if r.Total != len(r.Docs) {
+					t.Errorf("total %d, docs %d", r.Total, len(r.Docs))
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	s.WaitMerges()
+	if r := s.Find(termQuery("北京")); r.Total != len(s.docs) || len(s.docs) == n {
+		t.Errorf("total %d, want %d", r.Total, len(s.docs))
+	}
+	if s.mergeCandidates() != nil {
+		t.Errorf("%d segments not merged", len(s.segments))
+	}
+}
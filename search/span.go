@@ -0,0 +1,266 @@
+package search
+
+import (
+	"sort"
+)
+
+// PhraseQuery 查询依次相邻出现的词，如 606 主题中 中国 后紧跟 近代史。
+// 分词字段中每个词先分词，分词后的各部分也须相邻
+type PhraseQuery struct {
+	Field string
+	Terms []string
+}
+
+func (q *PhraseQuery) Match(t *Term) bool {
+	return t.Field == q.Field && len(q.Terms) == 1 && t.Value == q.Terms[0]
+}
+
+func (q *PhraseQuery) iterator(s *Searcher, seg *segment) docIterator {
+	return (&SpanNearQuery{q.Field, q.Terms, 0, true}).iterator(s, seg)
+}
+
+func (q *PhraseQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+// SpanNearQuery 查询 Terms 之间相隔不超过 Slop 个位置的文档，
+// InOrder 为 true 时各词须按顺序出现
+type SpanNearQuery struct {
+	Field   string
+	Terms   []string
+	Slop    int
+	InOrder bool
+}
+
+func (q *SpanNearQuery) Match(t *Term) bool {
+	if t.Field != q.Field {
+		return false
+	}
+	for _, v := range q.Terms {
+		if v == t.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *SpanNearQuery) iterator(s *Searcher, seg *segment) docIterator {
+	it := &spanIterator{slop: q.Slop, inOrder: q.InOrder}
+	its := []docIterator{}
+	a := s.analyzer(q.Field)
+	for _, v := range q.Terms {
+		c := &spanClause{}
+		if a == nil {
+			c.add(s, seg, &Term{q.Field, v}, 0)
+		} else {
+			for _, t := range a.Analyze(v) {
+				c.add(s, seg, &Term{q.Field, t.Text}, t.Position)
+			}
+		}
+		if len(c.terms) == 0 {
+			continue
+		}
+		for _, st := range c.terms {
+			if st.it == nil {
+				return &emptyIterator{-1}
+			}
+			its = append(its, st.it)
+		}
+		it.clauses = append(it.clauses, c)
+	}
+	if len(its) == 0 {
+		return &emptyIterator{-1}
+	}
+	it.conj = newConjunction(its)
+	return it
+}
+
+func (q *SpanNearQuery) Search(s *Searcher) *Index {
+	return searchIterator(s, q)
+}
+
+func searchIterator(s *Searcher, q Query) *Index {
+	res := drain(s.iterator(q))
+	if res.Size == 0 {
+		return nil
+	}
+	return res
+}
+
+type spanTerm struct {
+	it     *listIterator
+	offset int
+}
+
+// spanClause 为 SpanNearQuery 中的一个词，分词字段中可能由多个相邻的词组成
+type spanClause struct {
+	terms  []*spanTerm
+	length int
+}
+
+func (c *spanClause) add(s *Searcher, seg *segment, t *Term, offset int) {
+	st := &spanTerm{offset: offset}
+	if l, ok := s.termIterator(seg, t).(*listIterator); ok {
+		st.it = l
+	}
+	c.terms = append(c.terms, st)
+	if offset+1 > c.length {
+		c.length = offset + 1
+	}
+}
+
+// starts 返回当前文档中各词都出现在对应位置的起始位置
+func (c *spanClause) starts() []int {
+	res := []int{}
+	first := c.terms[0]
+	for _, p := range first.it.positions() {
+		start := p - first.offset
+		ok := true
+		for _, st := range c.terms[1:] {
+			if !containsInt(st.it.positions(), start+st.offset) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			res = append(res, start)
+		}
+	}
+	return res
+}
+
+func containsInt(a []int, v int) bool {
+	i := sort.SearchInts(a, v)
+	return i < len(a) && a[i] == v
+}
+
+// spanIterator 在所有词都出现的文档中检查位置，freq 为当前文档中匹配的次数
+type spanIterator struct {
+	conj    docIterator
+	clauses []*spanClause
+	slop    int
+	inOrder bool
+	freq    int
+}
+
+func (it *spanIterator) docID() int {
+	return it.conj.docID()
+}
+
+func (it *spanIterator) nextDoc() int {
+	return it.check(it.conj.nextDoc())
+}
+
+func (it *spanIterator) advance(target int) int {
+	return it.check(it.conj.advance(target))
+}
+
+func (it *spanIterator) check(d int) int {
+	for d != noMoreDocs {
+		it.freq = it.match()
+		if it.freq > 0 {
+			return d
+		}
+		d = it.conj.nextDoc()
+	}
+	return d
+}
+
+func (it *spanIterator) cost() int {
+	return it.conj.cost()
+}
+
+func (it *spanIterator) score() float64 {
+	sum := 0.0
+	for _, c := range it.clauses {
+		for _, st := range c.terms {
+			if st.it.scorer != nil {
+				sum += st.it.scorer.score(it.docID(), it.freq)
+			}
+		}
+	}
+	return sum
+}
+
+func (it *spanIterator) match() int {
+	starts := make([][]int, len(it.clauses))
+	total := 0
+	for i, c := range it.clauses {
+		starts[i] = c.starts()
+		if len(starts[i]) == 0 {
+			return 0
+		}
+		total += c.length
+	}
+	if it.inOrder {
+		return it.matchInOrder(starts, total)
+	}
+	return it.matchAnyOrder(starts, total)
+}
+
+// matchInOrder 对第一个词的每个位置，依次取后面各词最近的位置
+func (it *spanIterator) matchInOrder(starts [][]int, total int) int {
+	n := 0
+	for _, first := range starts[0] {
+		end := first + it.clauses[0].length
+		ok := true
+		for i := 1; i < len(starts); i++ {
+			j := sort.SearchInts(starts[i], end)
+			if j >= len(starts[i]) {
+				ok = false
+				break
+			}
+			end = starts[i][j] + it.clauses[i].length
+		}
+		if ok && end-first-total <= it.slop {
+			n++
+		}
+	}
+	return n
+}
+
+// matchAnyOrder 对每个起始位置，检查能否在 slop 允许的区间内为各词选出互不重叠的位置，
+// 同一个位置不能同时匹配两个词
+func (it *spanIterator) matchAnyOrder(starts [][]int, total int) int {
+	all := []int{}
+	for _, s := range starts {
+		all = append(all, s...)
+	}
+	sort.Ints(all)
+	n := 0
+	for i, first := range all {
+		if i > 0 && all[i-1] == first {
+			continue
+		}
+		if it.place(starts, 0, first, first+total+it.slop, nil) {
+			n++
+		}
+	}
+	return n
+}
+
+// place 为第 i 个及之后的词在 [first, limit) 内选择与 used 不重叠的位置，且有词从 first 开始
+func (it *spanIterator) place(starts [][]int, i int, first int, limit int, used [][2]int) bool {
+	if i == len(starts) {
+		for _, u := range used {
+			if u[0] == first {
+				return true
+			}
+		}
+		return false
+	}
+	l := it.clauses[i].length
+	for j := sort.SearchInts(starts[i], first); j < len(starts[i]) && starts[i][j]+l <= limit; j++ {
+		p, ok := starts[i][j], true
+		for _, u := range used {
+			if p < u[1] && u[0] < p+l {
+				ok = false
+				break
+			}
+		}
+		if ok && it.place(starts, i+1, first, limit, append(used, [2]int{p, p + l})) {
+			return true
+		}
+	}
+	return false
+}
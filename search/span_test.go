@@ -0,0 +1,146 @@
+package search
+
+import (
+	"testing"
+)
+
+func spanSearcher() *Searcher {
+	s := NewSearcher()
+	add := func(name string, terms ...string) {
+		s.Add(&Document{[]Field{
+			&IntField{BaseField{true, "id"}, s.docCurId},
+			&StrSliceField{BaseField{true, "term"}, terms},
+			&TextField{BaseField{true, "name"}, name},
+		}})
+	}
+	add("北京大学校史", "中国", "近代史", "史料")
+	add("北京的大学", "中国", "古代史")
+	add("大学在北京", "近代史", "中国")
+	add("北京历史", "中国", "经济", "近代史")
+	add("", "中国", "近代史", "中国", "近代史")
+	return s
+}
+
+func TestPhraseQuery(t *testing.T) {
+	s := spanSearcher()
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&PhraseQuery{"term", []string{"中国", "近代史"}}, []int{0, 4}},
+		{&PhraseQuery{"term", []string{"近代史", "中国"}}, []int{2, 4}},
+		{&PhraseQuery{"term", []string{"中国", "近代史", "史料"}}, []int{0}},
+		{&PhraseQuery{"term", []string{"中国", "南京"}}, []int{}},
+		{&PhraseQuery{"name", []string{"北京大学"}}, []int{0}},
+		{&PhraseQuery{"name", []string{"北京", "大学"}}, []int{}},
+		{&TermQuery{&Term{"name", "北京大学"}}, []int{0}},
+		{&TermQuery{&Term{"name", "北京"}}, []int{0, 1, 2, 3}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 文档 4 中短语出现两次，相关度更高
+	r := s.Find(&PhraseQuery{"term", []string{"中国", "近代史"}})
+	if got := ids(r); got[0] != 4 {
+		t.Errorf("ranking: %v, want 4 first", got)
+	}
+}
+
+func TestSpanNearQuery(t *testing.T) {
+	s := spanSearcher()
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&SpanNearQuery{"term", []string{"中国", "近代史"}, 0, true}, []int{0, 4}},
+		{&SpanNearQuery{"term", []string{"中国", "近代史"}, 1, true}, []int{0, 3, 4}},
+		{&SpanNearQuery{"term", []string{"中国", "近代史"}, 0, false}, []int{0, 2, 4}},
+		{&SpanNearQuery{"term", []string{"近代史", "中国"}, 1, false}, []int{0, 2, 3, 4}},
+		{&SpanNearQuery{"term", []string{"中国", "史料"}, 0, false}, []int{}},
+		{&SpanNearQuery{"term", []string{"中国", "史料"}, 1, true}, []int{0}},
+		{&SpanNearQuery{"name", []string{"北京", "大学"}, 2, true}, []int{0, 1}},
+		{&SpanNearQuery{"name", []string{"北京", "大学"}, 2, false}, []int{0, 1, 2}},
+		// 同一个位置不能匹配两个词
+		{&SpanNearQuery{"term", []string{"中国", "中国"}, 1, false}, []int{4}},
+		{&SpanNearQuery{"term", []string{"中国", "中国"}, 1, true}, []int{4}},
+		{&SpanNearQuery{"term", []string{"中国", "中国"}, 0, false}, []int{}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestPhraseAcrossValues(t *testing.T) {
+	s := NewSearcher()
+	s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, 0},
+		&StrSliceField{BaseField{true, "term"}, []string{"北京", "历史"}},
+		&StrSliceField{BaseField{true, "term"}, []string{"中国", "近代史"}},
+	}})
+	s.Add(&Document{[]Field{
+		&IntField{BaseField{true, "id"}, 1},
+		&StrSliceField{BaseField{true, "term"}, []string{"北京", "历史", "中国"}},
+	}})
+	cases := []struct {
+		q    Query
+		want []int
+	}{
+		{&PhraseQuery{"term", []string{"历史", "中国"}}, []int{1}},
+		{&PhraseQuery{"term", []string{"中国", "近代史"}}, []int{0}},
+		{&SpanNearQuery{"term", []string{"历史", "中国"}, 0, true}, []int{1}},
+		{&SpanNearQuery{"term", []string{"北京", "近代史"}, 5, false}, []int{}},
+		{&SpanNearQuery{"term", []string{"近代史", "中国"}, 1, false}, []int{0}},
+		{&TermQuery{&Term{"term", "近代史"}}, []int{0}},
+	}
+	for i, c := range cases {
+		if got := sortedIds(s.Find(c.q)); !equalIds(got, c.want) {
+			t.Errorf("case %d: %v, want %v", i, got, c.want)
+		}
+	}
+	// 词项数不含值之间的间隔
+	if n := s.norms["term"][0]; n != 4 {
+		t.Errorf("norm %d, want 4", n)
+	}
+}
+
+func TestParsePhrase(t *testing.T) {
+	s := spanSearcher()
+	cases := []struct {
+		q    string
+		want []int
+	}{
+		{`"中国 近代史"`, []int{0, 4}},
+		{`"中国 近代史"~1`, []int{0, 2, 3, 4}},
+		{`"中国 中国"~1`, []int{4}},
+		{`"中国 近代史" AND NOT 史料`, []int{4}},
+		{`name:"北京 大学"~2`, []int{0, 1, 2}},
+		{`"中国"`, []int{0, 1, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		q, err := ParseQuery(c.q, "term")
+		if err != nil {
+			t.Errorf("%s: %v", c.q, err)
+			continue
+		}
+		if got := sortedIds(s.Find(q)); !equalIds(got, c.want) {
+			t.Errorf("%s: %v, want %v", c.q, got, c.want)
+		}
+	}
+	_, err := ParseQuery(`"中国 近代史"~a`, "term")
+	if se, ok := err.(*SyntaxError); !ok || se.Pos != 8 {
+		t.Errorf("expect syntax error at 8, got %v", err)
+	}
+}
+
+func TestPositionsSaveLoad(t *testing.T) {
+	s := spanSearcher()
+	q := &PhraseQuery{"term", []string{"中国", "近代史"}}
+	l := saveLoad(t, s)
+	if got := ids(l.Find(q)); !equalIds(got, ids(s.Find(q))) {
+		t.Errorf("after load: %v, want %v", got, ids(s.Find(q)))
+	}
+}
@@ -0,0 +1,145 @@
+package search
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+func init() {
+	gob.Register(&IntField{})
+	gob.Register(&StrSliceField{})
+	gob.Register(&TextField{})
+}
+
+type storedIndex struct {
+	DocCurId int
+	Docs     map[int]*Document
+	Segments []*storedSegment
+	Norms    map[string][]int
+	Stats    map[string]*fieldStats
+	// Analyzed 为分词字段，加载后使用 DefaultAnalyzer，可通过 SetAnalyzer 修改
+	Analyzed map[string]bool
+	// FilterFields 为过滤字段，SortFields 为排序字段
+	FilterFields map[string]bool
+	SortFields   map[string]bool
+	// Deleted 为已删除但未压缩的文档
+	Deleted *bitmap
+}
+
+// storedSegment 为一个段的词典、倒排表、数值索引、doc values 及过滤字段的 bitmap
+type storedSegment struct {
+	Base      int
+	Max       int
+	Count     int
+	TermCurId int
+	Lexicon   map[Term]int
+	Postings  map[int]*storedPostings
+	Numeric   map[string]*numericIndex
+	DocValues map[string]*docValues
+	Bitmaps   map[int]*bitmap
+}
+
+// storedPostings 为压缩后的倒排表，直接保存不需重新编码
+type storedPostings struct {
+	Size      int
+	Last      int
+	Docs      []byte
+	Positions []byte
+	Skips     []skipEntry
+}
+
+// Save 将索引(各段的词典、倒排表及文档)以 gob 格式写入 w，正在写入的段作为最后一段保存
+func (s *Searcher) Save(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	si := &storedIndex{
+		DocCurId: s.docCurId,
+		Docs:     s.docs,
+		Norms:    s.norms,
+		Stats:    s.stats,
+		Analyzed: s.analyzed,
+
+		FilterFields: s.filterFields,
+		SortFields:   s.sortFields,
+		Deleted:      s.deleted,
+	}
+	for _, seg := range s.searchSegments() {
+		// 正在写入的段可能有未排序的数值
+		seg.dictMu.Lock()
+		seg.sortDicts()
+		seg.dictMu.Unlock()
+		ss := &storedSegment{
+			Base:      seg.base,
+			Max:       seg.max,
+			Count:     seg.count,
+			TermCurId: seg.termCurId,
+			Lexicon:   seg.lexicon,
+			Postings:  map[int]*storedPostings{},
+			Numeric:   seg.numeric,
+			DocValues: seg.docValues,
+			Bitmaps:   seg.bitmaps,
+		}
+		for tid, idx := range seg.indexes {
+			ss.Postings[tid] = &storedPostings{idx.Size, idx.last, idx.docs, idx.positions, idx.skips}
+		}
+		si.Segments = append(si.Segments, ss)
+	}
+	return gob.NewEncoder(w).Encode(si)
+}
+
+// Load 读取 Save 写入的索引，所有段都作为已封存的段
+func Load(r io.Reader) (*Searcher, error) {
+	si := &storedIndex{}
+	err := gob.NewDecoder(r).Decode(si)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSearcher()
+	s.docCurId = si.DocCurId
+	if si.Docs != nil {
+		s.docs = si.Docs
+	}
+	if si.Norms != nil {
+		s.norms = si.Norms
+	}
+	if si.Stats != nil {
+		s.stats = si.Stats
+	}
+	if si.Analyzed != nil {
+		s.analyzed = si.Analyzed
+	}
+	if si.FilterFields != nil {
+		s.filterFields = si.FilterFields
+	}
+	if si.SortFields != nil {
+		s.sortFields = si.SortFields
+	}
+	if si.Deleted != nil {
+		s.deleted = si.Deleted
+	}
+	for _, ss := range si.Segments {
+		seg := newSegment(ss.Base)
+		seg.max, seg.count, seg.termCurId = ss.Max, ss.Count, ss.TermCurId
+		if ss.Lexicon != nil {
+			seg.lexicon = ss.Lexicon
+		}
+		seg.buildDicts()
+		if ss.Numeric != nil {
+			seg.numeric = ss.Numeric
+			for _, ni := range seg.numeric {
+				ni.sorted = len(ni.Values)
+			}
+		}
+		if ss.DocValues != nil {
+			seg.docValues = ss.DocValues
+		}
+		if ss.Bitmaps != nil {
+			seg.bitmaps = ss.Bitmaps
+		}
+		for tid, p := range ss.Postings {
+			seg.indexes[tid] = &Index{p.Size, p.Last, p.Docs, p.Positions, p.Skips}
+		}
+		s.segments = append(s.segments, seg)
+	}
+	return s, nil
+}
@@ -0,0 +1,45 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	searcher := NewSearcher()
+	searcher.Add(&Document{[]Field{
+		&IntField{BaseField{true, "year"}, 1950}, &StrSliceField{BaseField{true, "term"}, []string{"北京", "历史"}},
+	}})
+	searcher.Add(&Document{[]Field{
+		&IntField{BaseField{true, "year"}, 1960}, &StrSliceField{BaseField{true, "term"}, []string{"上海", "历史"}},
+	}})
+	q := &TermQuery{&Term{"term", "历史"}}
+	before := searcher.Find(q)
+	buf := &bytes.Buffer{}
+	check(t, searcher.Save(buf))
+	loaded, err := Load(buf)
+	check(t, err)
+	after := loaded.Find(q)
+	if after.Total != before.Total || len(after.Docs) != len(before.Docs) {
+		t.Fatalf("total %d, want %d", after.Total, before.Total)
+	}
+	for i, d := range after.Docs {
+		if d.Fields[0].GetValue() != before.Docs[i].Fields[0].GetValue() {
+			t.Errorf("doc %d: %v, want %v", i, d.Fields[0].GetValue(), before.Docs[i].Fields[0].GetValue())
+		}
+	}
+}
+
+func saveLoad(t *testing.T, s *Searcher) *Searcher {
+	buf := &bytes.Buffer{}
+	check(t, s.Save(buf))
+	l, err := Load(buf)
+	check(t, err)
+	return l
+}
+
+func check(t *testing.T, err error) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
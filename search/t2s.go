@@ -0,0 +1,61 @@
+package search
+
+// t2sPairs 为常用繁体字及对应的简体字，每两个字为一组
+const t2sPairs = "" +
+	"來来係系個个們们備备傳传債债傷伤僑侨價价儀仪億亿優优儲储兒儿內内兩两冊册凍冻凱凯" +
+	"創创劃划劇剧劉刘動动務务勝胜勞劳勢势勵励勸劝區区協协叢丛吳吴員员問问喚唤單单嗎吗" +
+	"嘗尝噴喷嚮向嚴严國国圍围園园圓圆圖图團团報报場场墾垦壇坛壓压壞坏壯壮壽寿夢梦奪夺" +
+	"奮奋婦妇媽妈孫孙學学實实寧宁審审寫写寶宝將将專专尋寻對对導导屆届層层屬属島岛峽峡" +
+	"嶺岭巖岩帥帅師师帶带幣币幫帮幹干廈厦廟庙廠厂廢废廣广廳厅張张強强彈弹彙汇後后徑径" +
+	"從从復复徵征惡恶愛爱態态慶庆憂忧憑凭憲宪憶忆應应懷怀戀恋戰战戲戏戶户損损擁拥擇择" +
+	"擊击擔担據据擠挤擬拟擴扩擺摆攜携攝摄敗败敵敌數数斂敛斷断於于時时晉晋暈晕暫暂曆历" +
+	"曉晓書书會会朧胧東东條条棄弃楊杨業业極极榮荣構构槍枪樂乐樓楼標标樣样樹树橋桥機机" +
+	"橫横檔档檢检權权歐欧歡欢歲岁歷历歸归殘残殺杀殼壳毀毁毆殴氣气決决沒没況况淚泪淺浅" +
+	"測测準准溫温滅灭滬沪滿满漁渔漢汉漸渐潔洁澤泽濃浓濕湿濟济濱滨瀋沈灑洒灣湾災灾為为" +
+	"烏乌無无煙烟煩烦熱热燈灯營营爐炉爭争爺爷爾尔牆墙牽牵犧牺狀状獎奖獨独獲获獵猎獻献" +
+	"現现瑪玛環环瓊琼產产畢毕畫画異异當当疊叠療疗癒愈癥症發发盜盗盡尽監监盤盘盧卢眾众" +
+	"睜睁碩硕確确碼码礎础礙碍礦矿祿禄禍祸禪禅禮礼稅税種种稱称穀谷穩稳窩窝窮穷竊窃競竞" +
+	"筆笔箏筝節节範范築筑簡简簽签籃篮糧粮紀纪約约紅红純纯紙纸級级紛纷紡纺細细終终組组" +
+	"結结絕绝絡络給给統统絲丝經经綜综綠绿維维綱纲網网緊紧緒绪線线緣缘編编練练縣县縮缩" +
+	"總总績绩織织繩绳繪绘繼继續续罰罚罷罢羅罗義义習习翹翘聖圣聞闻聯联聰聪聲声聳耸職职" +
+	"聽听肅肃脈脉腦脑腳脚膚肤膽胆臉脸臨临臺台與与興兴舉举舊旧艦舰艱艰莊庄華华萬万葉叶" +
+	"葦苇蓋盖蔣蒋蕭萧薦荐薩萨藍蓝藝艺藥药蘇苏蘊蕴蘋苹蘭兰處处虛虚號号蝦虾蟲虫術术衛卫" +
+	"衝冲補补裝装製制複复襲袭見见規规視视親亲覺觉覽览觀观觸触訂订計计訊讯訓训託托記记" +
+	"訟讼訪访設设許许訴诉診诊註注評评詞词詢询試试詩诗話话該该詳详誇夸誌志認认誕诞語语" +
+	"誠诚誤误說说誰谁課课調调談谈請请論论講讲謝谢證证識识譚谭譜谱譯译議议護护讀读變变" +
+	"讓让豐丰豬猪貓猫貝贝負负財财貢贡貧贫貨货責责貴贵買买貸贷費费貿贸資资賈贾賓宾賠赔" +
+	"賣卖賦赋質质賬账賴赖購购賽赛贈赠贊赞贛赣趕赶趙赵趨趋跡迹踐践踴踊蹤踪躍跃軀躯車车" +
+	"軌轨軍军軟软較较載载輕轻輛辆輪轮輯辑輸输轄辖轉转辦办辭辞辯辩農农迴回這这連连週周" +
+	"進进遊游運运過过達达違违遙遥遞递遠远適适遲迟遷迁選选遺遗遼辽還还邊边邏逻郵邮鄉乡" +
+	"鄧邓鄭郑鄰邻醜丑醫医釋释針针釣钓鈴铃鉛铅銀银銅铜銷销鋒锋鋪铺鋼钢錄录錢钱錦锦錯错" +
+	"錶表鍋锅鍵键鍾钟鎖锁鎮镇鏡镜鐘钟鐵铁鑑鉴鑒鉴長长門门閃闪閉闭開开閒闲間间閣阁閥阀" +
+	"閩闽閱阅閻阎闆板闊阔關关陝陕陣阵陰阴陳陈陸陆陽阳隊队階阶際际隨随險险隱隐隸隶雖虽" +
+	"雙双雜杂雞鸡離离難难雲云電电霧雾靈灵靜静韋韦韓韩韻韵響响頁页頂顶項项順顺須须預预" +
+	"頓顿領领頭头頸颈頻频顆颗題题額额顏颜願愿類类顧顾顯显風风颱台飄飘飛飞飢饥飯饭飲饮" +
+	"養养餓饿餘余館馆饑饥馬马馮冯駐驻騎骑騙骗驅驱驗验驚惊體体髮发鬆松鬥斗鬧闹魚鱼魯鲁" +
+	"鮮鲜鳥鸟鳳凤鴻鸿鵬鹏鶴鹤鹽盐麗丽麥麦麼么黃黄點点黨党黴霉齊齐齒齿齡龄龍龙龔龚龜龟"
+
+var t2s = map[rune]rune{}
+
+func init() {
+	r := []rune(t2sPairs)
+	for i := 0; i+1 < len(r); i += 2 {
+		t2s[r[i]] = r[i+1]
+	}
+}
+
+// toSimplified 将 s 中的繁体字转为简体字
+func toSimplified(s string) string {
+	changed := false
+	r := []rune(s)
+	for i, c := range r {
+		if v, ok := t2s[c]; ok {
+			r[i] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return s
+	}
+	return string(r)
+}
@@ -12,6 +12,9 @@
         fontSize = d3.scale.sqrt().range([12,60]);
 
     var kcDrawed = false, kSearched = false;
+    var curAuthor = '';
+    var curTerms = [];
+    var facetNames = {term: '主题', year: '年份', author: '作者'};
     var words = [];
     var layout = d3.layout.cloud()
         .timeInterval(10)
@@ -88,11 +91,21 @@
 
     }
 
-    function search(word,year,page,limit){
+    function search(word,year,page,limit,author,terms){
+        author = author || '';
+        terms = terms || [];
+        curAuthor = author;
+        curTerms = terms;
         d3.select('#bookList form input[name=word]').property('value', word);
         d3.select('#bookList form select[name=year]').property('value', year);
+        var order = d3.select('#bookList form select[name=sort]').property('value')||'';
         var start = (page - 1) * limit;
-        d3.json('search.json?word=' + word + '&year=' + year + '&start=' + start + '&limit=' + limit, function(err, data){
+        var url = 'search.json?word=' + encodeURIComponent(word) + '&year=' + year +
+            '&author=' + encodeURIComponent(author) + '&start=' + start + '&limit=' + limit +
+            terms.map(function(t){ return '&term=' + encodeURIComponent(t); }).join('') +
+            '&sort=' + encodeURIComponent(order) +
+            '&facet=term&facet=year&facet=author';
+        d3.json(url, function(err, data){
             d3.select('#bookList ul.data-list').selectAll('li').remove();
             var e = d3.select('#bookList ul.data-list').selectAll('li').data(data.docs);
             e.enter().append('li').attr('class','book-item').html(function(d,i){
@@ -109,13 +122,46 @@
                 search(text, '', defPage, limit);
             });
             resetPager(page, limit, data.total);
+            resetFacets(data.facets || {}, word, year, author, terms, limit);
+        });
+    }
+
+    //点击分面的值时在当前条件上增加过滤条件
+    function resetFacets(facets, word, year, author, terms, limit){
+        var box = d3.select('#bookList .facets');
+        box.selectAll('dl').remove();
+        ['term', 'year', 'author'].forEach(function(name){
+            var values = facets[name] || [];
+            if(values.length == 0){
+                return;
+            }
+            var dl = box.append('dl');
+            dl.append('dt').text(facetNames[name]);
+            var dd = dl.selectAll('dd').data(values).enter().append('dd')
+                .classed('active', function(d){
+                    return (name == 'term' && (d.value == word || terms.indexOf(d.value) >= 0)) || (name == 'year' && d.value == year) || (name == 'author' && d.value == author);
+                });
+            //取值来自书目数据，用 text 写入，不作为 HTML 解析
+            dd.append('span').text(function(d){ return d.value; });
+            dd.append('i').text(function(d){ return d.count; });
+            dd.on('click', function(d){
+                if(name == 'term'){
+                    if(d.value != word && terms.indexOf(d.value) < 0){
+                        search(word, year, defPage, limit, author, terms.concat([d.value]));
+                    }
+                }else if(name == 'year'){
+                    search(word, d.value, defPage, limit, author, terms);
+                }else{
+                    search(word, year, defPage, limit, d.value, terms);
+                }
+            });
         });
     }
 
     function searchPage(page, size){
         var word = d3.select('#bookList form').select('input[name=word]').property('value')||'';
         var year = d3.select('#bookList form').select('select[name=year]').property('value')||'';
-        search(word, year, page, size);
+        search(word, year, page, size, curAuthor, curTerms);
     }
 
     function searchWord(word, page, size){
@@ -268,6 +314,11 @@
         search(word, year, defPage, defSize);
     });
 
+    //切换排序时保留当前条件，回到第一页
+    d3.select('#bookList form select[name=sort]').on('change',function(){
+        searchPage(defPage, defSize);
+    });
+
     d3.select('#tlScale').on('change',function(){
         if(timelineData){
             drawTimeline(timelineData);